@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Animation describes figures moving over time. It is loaded from a YAML or
+// JSON file.
+type Animation struct {
+	// FPS is the number of frames sent to the server per second.
+	FPS float64 `json:"fps" yaml:"fps"`
+	// Loop is one of "once", "repeat" or "pingpong".
+	Loop string `json:"loop" yaml:"loop"`
+	// Mode is "redraw", which resets the canvas and draws every figure on
+	// each frame, or "move", which moves the figures already on the canvas
+	// and needs exactly one figure in the animation.
+	Mode string `json:"mode" yaml:"mode"`
+	// Backdrop is a script drawn under the figures on every redraw frame.
+	Backdrop string   `json:"backdrop" yaml:"backdrop"`
+	Figures  []Figure `json:"figures" yaml:"figures"`
+}
+
+type Point struct {
+	X float64 `json:"x" yaml:"x"`
+	Y float64 `json:"y" yaml:"y"`
+}
+
+// Figure follows either a list of keyframes or a path.
+type Figure struct {
+	Name      string     `json:"name" yaml:"name"`
+	Keyframes []Keyframe `json:"keyframes" yaml:"keyframes"`
+	Path      *Path      `json:"path" yaml:"path"`
+}
+
+// Keyframe pins a figure to a position at a time in seconds. Ease controls
+// the transition from the previous keyframe.
+type Keyframe struct {
+	Time float64 `json:"time" yaml:"time"`
+	X    float64 `json:"x" yaml:"x"`
+	Y    float64 `json:"y" yaml:"y"`
+	Ease string  `json:"ease" yaml:"ease"`
+}
+
+type Box struct {
+	X1 float64 `json:"x1" yaml:"x1"`
+	Y1 float64 `json:"y1" yaml:"y1"`
+	X2 float64 `json:"x2" yaml:"x2"`
+	Y2 float64 `json:"y2" yaml:"y2"`
+}
+
+// Path is a parametric trajectory. Which fields are used depends on Type:
+//
+//	line:   From, To
+//	circle: Center, Radius, StartAngle (degrees), Turns (negative turns
+//	        go counter-clockwise, default 1)
+//	bezier: Points (two or more control points)
+//	bounce: Box, Start, Velocity (pixels per second)
+//
+// Duration is the time in seconds to walk the path once. A bounce path
+// without a duration never ends.
+type Path struct {
+	Type       string  `json:"type" yaml:"type"`
+	Duration   float64 `json:"duration" yaml:"duration"`
+	Ease       string  `json:"ease" yaml:"ease"`
+	From       Point   `json:"from" yaml:"from"`
+	To         Point   `json:"to" yaml:"to"`
+	Center     Point   `json:"center" yaml:"center"`
+	Radius     float64 `json:"radius" yaml:"radius"`
+	StartAngle float64 `json:"start_angle" yaml:"start_angle"`
+	Turns      float64 `json:"turns" yaml:"turns"`
+	Points     []Point `json:"points" yaml:"points"`
+	Box        *Box    `json:"box" yaml:"box"`
+	Start      Point   `json:"start" yaml:"start"`
+	Velocity   Point   `json:"velocity" yaml:"velocity"`
+}
+
+// LoadAnimation reads an animation from a .json file or, for any other
+// extension, from YAML.
+func LoadAnimation(name string) (*Animation, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var a Animation
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&a)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&a)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := a.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &a, nil
+}
+
+func (a *Animation) validate() error {
+	if a.FPS == 0 {
+		a.FPS = 30
+	}
+	if a.FPS < 0 {
+		return fmt.Errorf("fps must be positive")
+	}
+	switch a.Loop {
+	case "":
+		a.Loop = "repeat"
+	case "once", "repeat", "pingpong":
+	default:
+		return fmt.Errorf("unknown loop mode %q", a.Loop)
+	}
+	switch a.Mode {
+	case "":
+		a.Mode = "redraw"
+	case "redraw":
+	case "move":
+		if len(a.Figures) != 1 {
+			return fmt.Errorf("move mode needs exactly one figure")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", a.Mode)
+	}
+	if len(a.Figures) == 0 {
+		return fmt.Errorf("no figures")
+	}
+	for i := range a.Figures {
+		if err := a.Figures[i].validate(); err != nil {
+			name := a.Figures[i].Name
+			if name == "" {
+				name = fmt.Sprint(i + 1)
+			}
+			return fmt.Errorf("figure %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (f *Figure) validate() error {
+	if (f.Path == nil) == (len(f.Keyframes) == 0) {
+		return fmt.Errorf("needs either keyframes or a path")
+	}
+	for i, k := range f.Keyframes {
+		if i > 0 && k.Time <= f.Keyframes[i-1].Time {
+			return fmt.Errorf("keyframe times must increase")
+		}
+		if _, ok := easings[k.Ease]; !ok {
+			return fmt.Errorf("unknown ease %q", k.Ease)
+		}
+	}
+	if p := f.Path; p != nil {
+		if _, ok := easings[p.Ease]; !ok {
+			return fmt.Errorf("unknown ease %q", p.Ease)
+		}
+		if p.Duration < 0 || (p.Duration == 0 && p.Type != "bounce") {
+			return fmt.Errorf("%s path needs a positive duration", p.Type)
+		}
+		switch p.Type {
+		case "line":
+		case "circle":
+			if p.Radius <= 0 {
+				return fmt.Errorf("circle path needs a positive radius")
+			}
+			if p.Turns == 0 {
+				p.Turns = 1
+			}
+		case "bezier":
+			if len(p.Points) < 2 {
+				return fmt.Errorf("bezier path needs at least two points")
+			}
+		case "bounce":
+			if p.Box == nil || p.Box.X2 <= p.Box.X1 || p.Box.Y2 <= p.Box.Y1 {
+				return fmt.Errorf("bounce path needs a non-empty box")
+			}
+		default:
+			return fmt.Errorf("unknown path type %q", p.Type)
+		}
+	}
+	return nil
+}
+
+// Duration returns the length of one pass of the figure's motion, or +Inf if
+// it never ends.
+func (f *Figure) Duration() float64 {
+	if f.Path != nil {
+		if f.Path.Duration == 0 {
+			return math.Inf(1)
+		}
+		return f.Path.Duration
+	}
+	return f.Keyframes[len(f.Keyframes)-1].Time
+}
+
+// Duration returns the length of one pass of the whole animation.
+func (a *Animation) Duration() float64 {
+	var d float64
+	for i := range a.Figures {
+		d = math.Max(d, a.Figures[i].Duration())
+	}
+	return d
+}
+
+// LocalTime maps the time since the start of playback to the time within
+// one pass of the animation according to the loop mode. done reports that a
+// "once" animation has finished.
+func (a *Animation) LocalTime(t float64) (local float64, done bool) {
+	d := a.Duration()
+	if d == 0 || math.IsInf(d, 1) {
+		return t, false
+	}
+	switch a.Loop {
+	case "once":
+		return math.Min(t, d), t >= d
+	case "pingpong":
+		t = math.Mod(t, 2*d)
+		if t > d {
+			t = 2*d - t
+		}
+		return t, false
+	}
+	return math.Mod(t, d), false
+}
+
+// Position returns the figure position at time t within the animation.
+func (f *Figure) Position(t float64) Point {
+	if f.Path != nil {
+		return f.Path.at(t)
+	}
+	ks := f.Keyframes
+	if t <= ks[0].Time {
+		return Point{ks[0].X, ks[0].Y}
+	}
+	for i := 1; i < len(ks); i++ {
+		if t <= ks[i].Time {
+			p := easings[ks[i].Ease]((t - ks[i-1].Time) / (ks[i].Time - ks[i-1].Time))
+			return lerp(Point{ks[i-1].X, ks[i-1].Y}, Point{ks[i].X, ks[i].Y}, p)
+		}
+	}
+	last := ks[len(ks)-1]
+	return Point{last.X, last.Y}
+}
+
+func (p *Path) at(t float64) Point {
+	if p.Type == "bounce" {
+		if p.Duration > 0 {
+			t = math.Min(t, p.Duration)
+		}
+		b := p.Box
+		return Point{
+			X: reflect(p.Start.X+p.Velocity.X*t, b.X1, b.X2),
+			Y: reflect(p.Start.Y+p.Velocity.Y*t, b.Y1, b.Y2),
+		}
+	}
+
+	progress := easings[p.Ease](math.Max(0, math.Min(1, t/p.Duration)))
+	switch p.Type {
+	case "line":
+		return lerp(p.From, p.To, progress)
+	case "circle":
+		a := (p.StartAngle + 360*p.Turns*progress) * math.Pi / 180
+		return Point{p.Center.X + p.Radius*math.Cos(a), p.Center.Y + p.Radius*math.Sin(a)}
+	case "bezier":
+		pts := append([]Point(nil), p.Points...)
+		for n := len(pts) - 1; n > 0; n-- {
+			for i := 0; i < n; i++ {
+				pts[i] = lerp(pts[i], pts[i+1], progress)
+			}
+		}
+		return pts[0]
+	}
+	return Point{}
+}
+
+// reflect folds v into [lo, hi] as if it bounced off both ends.
+func reflect(v, lo, hi float64) float64 {
+	span := hi - lo
+	m := math.Mod(v-lo, 2*span)
+	if m < 0 {
+		m += 2 * span
+	}
+	if m > span {
+		m = 2*span - m
+	}
+	return lo + m
+}
+
+func lerp(a, b Point, p float64) Point {
+	return Point{a.X + (b.X-a.X)*p, a.Y + (b.Y-a.Y)*p}
+}
+
+var easings = map[string]func(float64) float64{
+	"":       func(p float64) float64 { return p },
+	"linear": func(p float64) float64 { return p },
+	"in":     func(p float64) float64 { return p * p },
+	"out":    func(p float64) float64 { return 1 - (1-p)*(1-p) },
+	"in-out": func(p float64) float64 {
+		if p < 0.5 {
+			return 2 * p * p
+		}
+		return 1 - 2*(1-p)*(1-p)
+	},
+}
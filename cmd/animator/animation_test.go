@@ -0,0 +1,186 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+func near(a, b Point) bool {
+	return math.Abs(a.X-b.X) < 1e-9 && math.Abs(a.Y-b.Y) < 1e-9
+}
+
+func TestFigure_Position(t *testing.T) {
+	tests := []struct {
+		name string
+		fig  Figure
+		t    float64
+		want Point
+	}{
+		{
+			name: "keyframes interpolate",
+			fig:  Figure{Keyframes: []Keyframe{{Time: 0, X: 0, Y: 0}, {Time: 2, X: 100, Y: 50}}},
+			t:    1,
+			want: Point{50, 25},
+		},
+		{
+			name: "keyframes ease in",
+			fig:  Figure{Keyframes: []Keyframe{{Time: 0}, {Time: 1, X: 100, Ease: "in"}}},
+			t:    0.5,
+			want: Point{25, 0},
+		},
+		{
+			name: "keyframes hold the last position",
+			fig:  Figure{Keyframes: []Keyframe{{Time: 0}, {Time: 1, X: 100, Y: 100}}},
+			t:    5,
+			want: Point{100, 100},
+		},
+		{
+			name: "line",
+			fig:  Figure{Path: &Path{Type: "line", Duration: 4, From: Point{0, 0}, To: Point{400, 800}}},
+			t:    1,
+			want: Point{100, 200},
+		},
+		{
+			name: "circle quarter turn",
+			fig:  Figure{Path: &Path{Type: "circle", Duration: 4, Center: Point{400, 400}, Radius: 100, Turns: 1}},
+			t:    1,
+			want: Point{400, 500},
+		},
+		{
+			name: "quadratic bezier midpoint",
+			fig:  Figure{Path: &Path{Type: "bezier", Duration: 1, Points: []Point{{0, 0}, {50, 100}, {100, 0}}}},
+			t:    0.5,
+			want: Point{50, 50},
+		},
+		{
+			name: "bounce reflects off the box",
+			fig: Figure{Path: &Path{
+				Type:     "bounce",
+				Box:      &Box{X2: 800, Y2: 800},
+				Start:    Point{100, 100},
+				Velocity: Point{100, -150},
+			}},
+			t:    8,
+			want: Point{700, 500},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fig.validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.fig.Position(tt.t); !near(got, tt.want) {
+				t.Errorf("Position(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnimation_LocalTime(t *testing.T) {
+	a := Animation{Figures: []Figure{{Path: &Path{Type: "line", Duration: 2}}}}
+	tests := []struct {
+		loop     string
+		t        float64
+		want     float64
+		wantDone bool
+	}{
+		{"once", 1, 1, false},
+		{"once", 3, 2, true},
+		{"repeat", 3, 1, false},
+		{"pingpong", 3, 1, false},
+		{"pingpong", 4.5, 0.5, false},
+	}
+	for _, tt := range tests {
+		a.Loop = tt.loop
+		if got, done := a.LocalTime(tt.t); got != tt.want || done != tt.wantDone {
+			t.Errorf("%s LocalTime(%v) = %v, %v, want %v, %v", tt.loop, tt.t, got, done, tt.want, tt.wantDone)
+		}
+	}
+}
+
+func TestLoadAnimation(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	yml := write("a.yaml", `
+fps: 10
+loop: pingpong
+backdrop: white
+figures:
+  - name: orbit
+    path: {type: circle, duration: 2, center: {x: 400, y: 400}, radius: 100}
+  - name: walker
+    keyframes:
+      - {time: 0, x: 0, y: 0}
+      - {time: 1, x: 100, y: 0}
+`)
+	a, err := LoadAnimation(yml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.FPS != 10 || a.Mode != "redraw" || len(a.Figures) != 2 || a.Duration() != 2 {
+		t.Errorf("unexpected animation: %+v", a)
+	}
+	if want := "reset\nwhite\nfigure 500 400\nfigure 0 0\nupdate\n"; a.Frame(0) != want {
+		t.Errorf("Frame(0) = %q, want %q", a.Frame(0), want)
+	}
+
+	js := write("a.json", `{"mode":"move","figures":[{"path":{"type":"line","duration":1,"to":{"x":10,"y":20}}}]}`)
+	if a, err = LoadAnimation(js); err != nil {
+		t.Fatal(err)
+	}
+	if want := "move 10 20\nupdate\n"; a.Frame(1) != want {
+		t.Errorf("Frame(1) = %q, want %q", a.Frame(1), want)
+	}
+
+	bad := []struct{ name, data, want string }{
+		{"unknown.yaml", "figures: []\nspeed: 2\n", "field speed not found"},
+		{"empty.yaml", "fps: 5\n", "no figures"},
+		{"both.json", `{"figures":[{"path":{"type":"line","duration":1},"keyframes":[{"time":0}]}]}`, "either keyframes or a path"},
+		{"path.json", `{"figures":[{"name":"a","path":{"type":"spiral","duration":1}}]}`, `figure a: unknown path type "spiral"`},
+		{"move.json", `{"mode":"move","figures":[{"keyframes":[{"time":0}]},{"keyframes":[{"time":0}]}]}`, "exactly one figure"},
+	}
+	for _, tt := range bad {
+		if _, err := LoadAnimation(write(tt.name, tt.data)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestOrbit_DefaultLimits plays the example animation against a painter
+// with the default limits and checks that it is never throttled.
+func TestOrbit_DefaultLimits(t *testing.T) {
+	a, err := LoadAnimation(filepath.Join("..", "..", "scripts", "orbit.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	limiter := &lang.Limiter{Rate: lang.DefaultRate, Burst: lang.DefaultBurst, Now: func() time.Time { return now }}
+	// The Loop is not started: the commands only need to be charged.
+	handler := limiter.Limit(lang.HttpHandler(&painter.Loop{}, &lang.Parser{}))
+
+	frame := time.Duration(float64(time.Second) / a.FPS)
+	for i := range int(10 * 60 * a.FPS) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(a.Frame(float64(i)/a.FPS))))
+		if w.Code != http.StatusOK {
+			t.Fatalf("frame %d at %v: status %d: %s", i, now.Sub(time.Unix(0, 0)), w.Code, w.Body)
+		}
+		now = now.Add(frame)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+)
+
+// client posts frames to the painter server over one keep-alive HTTP client
+// and backs off exponentially while the server is unreachable.
+type client struct {
+	base string
+	http *http.Client
+
+	backoff time.Duration
+	// retryAt is the earliest time the next frame may be sent after a failure.
+	retryAt time.Time
+	// offline is set after a failure and cleared by a successful resync.
+	offline bool
+}
+
+func newClient(base, token string) *client {
+	return &client{
+		base: strings.TrimSuffix(base, "/"),
+		http: &http.Client{
+			Timeout: 2 * time.Second,
+			Transport: &lang.BearerTransport{
+				Token: token,
+				Base: &http.Transport{
+					MaxIdleConnsPerHost: 2,
+					IdleConnTimeout:     30 * time.Second,
+				},
+			},
+		},
+	}
+}
+
+// ready reports whether the backoff period after a failure is over.
+func (c *client) ready(now time.Time) bool {
+	return !now.Before(c.retryAt)
+}
+
+// sendFrame posts a frame script and returns the request latency.
+func (c *client) sendFrame(ctx context.Context, script string) (time.Duration, error) {
+	start := time.Now()
+	err := c.post(ctx, script)
+	var limited *rateLimitedError
+	if errors.As(err, &limited) {
+		// The server is up, it only wants fewer frames.
+		c.retryAt = time.Now().Add(limited.after)
+		return 0, err
+	}
+	if err != nil {
+		c.fail()
+		return 0, err
+	}
+	c.backoff = 0
+	return time.Since(start), nil
+}
+
+func (c *client) post(ctx context.Context, script string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+"/", strings.NewReader(script))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		secs, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return &rateLimitedError{after: time.Duration(max(secs, 1)) * time.Second}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// rateLimitedError is returned for frames the server rejected with 429.
+type rateLimitedError struct {
+	after time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited by the server for %v", e.after)
+}
+
+// fail schedules the next attempt after a doubled, jittered backoff.
+func (c *client) fail() {
+	c.offline = true
+	c.backoff = min(max(2*c.backoff, minBackoff), maxBackoff)
+	jitter := time.Duration(rand.Int64N(int64(c.backoff / 2)))
+	c.retryAt = time.Now().Add(c.backoff/2 + jitter)
+}
+
+// resync fetches the scene after the server came back. In move mode a
+// restarted server may have lost the animated figure, so it is drawn again.
+func (c *client) resync(ctx context.Context, a *Animation, t float64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/scene", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.fail()
+		return err
+	}
+	defer resp.Body.Close()
+	var scene painter.Scene
+	if resp.StatusCode != http.StatusOK {
+		c.fail()
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&scene); err != nil {
+		c.fail()
+		return err
+	}
+
+	if a.Mode == "move" && len(scene.Figures) == 0 {
+		p := a.Figures[0].Position(t)
+		if err := c.post(ctx, fmt.Sprintf("figure %d %d\n", round(p.X), round(p.Y))); err != nil {
+			c.fail()
+			return err
+		}
+	}
+	c.offline = false
+	return nil
+}
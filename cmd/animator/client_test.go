@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlay_Reconnects(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		down     = true
+		requests []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/scene" {
+			requests = append(requests, "GET /scene")
+			_, _ = io.WriteString(rw, `{"background":"#008000ff","figures":[]}`)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+strings.TrimSpace(string(body)))
+	}))
+	defer srv.Close()
+
+	anim := &Animation{
+		FPS:  50,
+		Loop: "once",
+		Mode: "move",
+		Figures: []Figure{{
+			Path: &Path{Type: "line", Duration: 0.6, From: Point{0, 0}, To: Point{600, 0}},
+		}},
+	}
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		mu.Lock()
+		down = false
+		mu.Unlock()
+	}()
+
+	st := play(context.Background(), anim, newClient(srv.URL, ""))
+
+	if st.failed == 0 {
+		t.Error("expected failed frames while the server was down")
+	}
+	if st.sent == 0 || st.sent+st.dropped() < 25 {
+		t.Errorf("sent %d, dropped %d: too few frames for 0.6s at 50 fps", st.sent, st.dropped())
+	}
+	if len(st.latencies) != st.sent {
+		t.Errorf("%d latencies for %d sent frames", len(st.latencies), st.sent)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) < 3 || requests[0] != "GET /scene" || !strings.HasPrefix(requests[1], "POST figure ") {
+		t.Fatalf("requests after reconnect = %q, want a scene resync and the figure redrawn first", requests)
+	}
+	if last := requests[len(requests)-1]; last != "POST move 600 0\nupdate" {
+		t.Errorf("last request = %q, want the final frame", last)
+	}
+}
+
+func TestStats_Percentile(t *testing.T) {
+	var st stats
+	for i := 1; i <= 100; i++ {
+		st.delivered(time.Duration(i) * time.Millisecond)
+	}
+	st.failed, st.skipped = 2, 3
+	if got := st.percentile(50); got != 50*time.Millisecond {
+		t.Errorf("p50 = %v, want 50ms", got)
+	}
+	if got := st.percentile(100); got != 100*time.Millisecond {
+		t.Errorf("max = %v, want 100ms", got)
+	}
+	var out strings.Builder
+	st.print(&out)
+	if !strings.Contains(out.String(), "100 sent, 5 dropped (2 failed, 3 skipped)") {
+		t.Errorf("print() = %q", out.String())
+	}
+}
@@ -1,54 +1,148 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"net/http"
-	"net/url"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
-func sendCommand(cmd string) error {
-	resp, err := http.Get("http://localhost:17000/?cmd=" + url.QueryEscape(cmd))
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("bad status: %s", resp.Status)
-	}
-	return nil
+var (
+	server = flag.String("server", "http://localhost:17000", "painter server URL")
+	speed  = flag.Float64("speed", 1, "playback speed multiplier")
+	token  = flag.String("token", os.Getenv("PAINTER_TOKEN"), "API token of the painter server, with the read and draw scopes")
+)
+
+// defaultAnimation is played when no file is given: a figure bouncing
+// around the canvas from (100,100), moving by (10,15) once a second.
+var defaultAnimation = Animation{
+	FPS:  1,
+	Loop: "repeat",
+	Mode: "move",
+	Figures: []Figure{{
+		Name: "default",
+		Path: &Path{
+			Type:     "bounce",
+			Box:      &Box{X1: 0, Y1: 0, X2: 800, Y2: 800},
+			Start:    Point{100, 100},
+			Velocity: Point{10, 15},
+		},
+	}},
 }
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: animator [flags] [animation.yaml|animation.json]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *speed <= 0 {
+		fmt.Fprintln(os.Stderr, "speed must be positive")
+		os.Exit(2)
+	}
+
+	anim := &defaultAnimation
+	if flag.NArg() > 0 {
+		var err error
+		if anim, err = LoadAnimation(flag.Arg(0)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	fmt.Println("Starting animation client")
+	st := play(ctx, anim, newClient(*server, *token))
+	st.print(os.Stdout)
+}
 
-	x, y := 100, 100
-	dx, dy := 10, 15
+// play sends frames until a "once" animation ends or ctx is cancelled.
+// Frames that are due while the server is unreachable are dropped.
+func play(ctx context.Context, anim *Animation, c *client) *stats {
+	var st stats
+	interval := time.Duration(float64(time.Second) / anim.FPS)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	start := time.Now()
+	last := -1
 
 	for {
-		cmdMove := fmt.Sprintf("move %d %d", x, y)
-		if err := sendCommand(cmdMove); err != nil {
-			fmt.Println("Error sending move:", err)
-		} else {
-			fmt.Println("Sent:", cmdMove)
+		now := time.Now()
+		elapsed := now.Sub(start)
+		// Ticks missed because a request outlived the frame interval.
+		idx := int(elapsed / interval)
+		if last >= 0 && idx > last+1 {
+			st.skipped += idx - last - 1
 		}
+		last = idx
+		t, done := anim.LocalTime(elapsed.Seconds() * *speed)
 
-		if err := sendCommand("update"); err != nil {
-			fmt.Println("Error sending update:", err)
-		} else {
-			fmt.Println("Sent: update")
-		}
+		switch {
+		case !c.ready(now):
+			st.skipped++
 
-		x += dx
-		y += dy
+		case c.offline:
+			if err := c.resync(ctx, anim, t); err != nil {
+				st.failed++
+				if ctx.Err() == nil {
+					fmt.Printf("Server unreachable: %s (retrying in %v)\n", err, time.Until(c.retryAt).Round(time.Millisecond))
+				}
+				break
+			}
+			fmt.Println("Reconnected to server")
+			fallthrough
 
-		if x < 0 || x > 800 {
-			dx = -dx
+		default:
+			latency, err := c.sendFrame(ctx, anim.Frame(t))
+			if err != nil {
+				st.failed++
+				if ctx.Err() == nil {
+					fmt.Printf("Error sending frame: %s (retrying in %v)\n", err, time.Until(c.retryAt).Round(time.Millisecond))
+				}
+				break
+			}
+			st.delivered(latency)
 		}
-		if y < 0 || y > 800 {
-			dy = -dy
+
+		if done {
+			return &st
 		}
+		select {
+		case <-ctx.Done():
+			return &st
+		case <-ticker.C:
+		}
+	}
+}
 
-		time.Sleep(1 * time.Second)
+// Frame returns the script that draws the animation at time t.
+func (a *Animation) Frame(t float64) string {
+	var b strings.Builder
+	if a.Mode == "move" {
+		p := a.Figures[0].Position(t)
+		fmt.Fprintf(&b, "move %d %d\n", round(p.X), round(p.Y))
+	} else {
+		b.WriteString("reset\n")
+		if a.Backdrop != "" {
+			b.WriteString(strings.TrimSpace(a.Backdrop))
+			b.WriteString("\n")
+		}
+		for i := range a.Figures {
+			p := a.Figures[i].Position(t)
+			fmt.Fprintf(&b, "figure %d %d\n", round(p.X), round(p.Y))
+		}
 	}
+	b.WriteString("update\n")
+	return b.String()
+}
+
+func round(v float64) int {
+	return int(math.Round(v))
 }
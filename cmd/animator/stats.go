@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// stats collects delivery statistics of a playback session.
+type stats struct {
+	sent      int
+	failed    int
+	skipped   int
+	latencies []time.Duration
+}
+
+func (s *stats) delivered(latency time.Duration) {
+	s.sent++
+	s.latencies = append(s.latencies, latency)
+}
+
+// dropped counts frames that never reached the server, either because a
+// request failed or because the frame was skipped.
+func (s *stats) dropped() int {
+	return s.failed + s.skipped
+}
+
+func (s *stats) percentile(p float64) time.Duration {
+	if len(s.latencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(s.latencies)
+	slices.Sort(sorted)
+	i := int(p / 100 * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+func (s *stats) print(w io.Writer) {
+	fmt.Fprintf(w, "frames: %d sent, %d dropped (%d failed, %d skipped)\n",
+		s.sent, s.dropped(), s.failed, s.skipped)
+	if len(s.latencies) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "latency: p50 %v, p90 %v, p99 %v, max %v\n",
+		s.percentile(50).Round(time.Microsecond),
+		s.percentile(90).Round(time.Microsecond),
+		s.percentile(99).Round(time.Microsecond),
+		s.percentile(100).Round(time.Microsecond))
+}
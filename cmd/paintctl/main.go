@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+const usage = `Usage: paintctl [-server URL] [-token TOKEN] <command> [arguments]
+
+Commands:
+  run <file>            send a script file ("-" reads standard input)
+  exec "<cmd>"          send a single command
+  snapshot [-o file]    save the last presented frame as PNG
+  scene get [-o file]   print the current scene as JSON
+  scene put [file]      replace the scene with JSON from a file or stdin
+  watch                 print events as the server handles operations
+  repl                  start an interactive shell
+`
+
+var (
+	server = flag.String("server", "http://localhost:17000", "painter server URL")
+	token  = flag.String("token", os.Getenv("PAINTER_TOKEN"), "API token of the painter server")
+)
+
+// errFailed signals that the failure has already been reported to the user.
+var errFailed = errors.New("failed")
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &client{base: strings.TrimSuffix(*server, "/"), http: &http.Client{Transport: &lang.BearerTransport{Token: *token}}}
+	args := flag.Args()[1:]
+
+	var err error
+	switch flag.Arg(0) {
+	case "run":
+		err = runCmd(c, args)
+	case "exec":
+		err = execCmd(c, args)
+	case "snapshot":
+		err = snapshotCmd(c, args)
+	case "scene":
+		err = sceneCmd(c, args)
+	case "watch":
+		err = watchCmd(c)
+	case "repl":
+		err = replCmd(c)
+	default:
+		fmt.Fprintf(os.Stderr, "paintctl: unknown command %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		if !errors.Is(err, errFailed) {
+			fmt.Fprintln(os.Stderr, "paintctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func runCmd(c *client, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("run requires a file name")
+	}
+	var (
+		script []byte
+		err    error
+	)
+	if args[0] == "-" {
+		script, err = io.ReadAll(os.Stdin)
+	} else {
+		script, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return report(args[0], string(script))(c.post(string(script)))
+}
+
+func execCmd(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("exec requires a command")
+	}
+	script := strings.Join(args, " ")
+	return report("<exec>", script)(c.post(script))
+}
+
+func snapshotCmd(c *client, args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	out := fs.String("o", "frame.png", "output file")
+	_ = fs.Parse(args)
+
+	resp, err := c.get("/frame.png")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := writeOutput(*out, resp.Body); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "saved frame %s to %s\n", resp.Header.Get("X-Frame-Seq"), *out)
+	return nil
+}
+
+func sceneCmd(c *client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("scene requires get or put")
+	}
+	switch args[0] {
+	case "get":
+		fs := flag.NewFlagSet("scene get", flag.ExitOnError)
+		out := fs.String("o", "-", "output file")
+		_ = fs.Parse(args[1:])
+
+		resp, err := c.get("/scene")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var pretty bytes.Buffer
+		body, err := io.ReadAll(resp.Body)
+		if err == nil {
+			err = json.Indent(&pretty, body, "", "  ")
+		}
+		if err != nil {
+			return err
+		}
+		return writeOutput(*out, &pretty)
+
+	case "put":
+		in := io.Reader(os.Stdin)
+		if len(args) > 1 && args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		req, err := http.NewRequest(http.MethodPut, c.base+"/scene", in)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return report("scene", "")(c.do(req))
+	}
+	return fmt.Errorf("unknown scene command %q", args[0])
+}
+
+func watchCmd(c *client) error {
+	resp, err := c.get("/events")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var ev painter.Event
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return err
+		}
+		fmt.Printf("%s  frame %-6d %s\n", ev.Time.Format(time.TimeOnly+".000"), ev.Frame, ev.Op)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("server closed the event stream")
+}
+
+func writeOutput(name string, r io.Reader) error {
+	if name == "-" {
+		_, err := io.Copy(os.Stdout, r)
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type client struct {
+	base string
+	http *http.Client
+}
+
+func (c *client) get(path string) (*http.Response, error) {
+	resp, err := c.http.Get(c.base + path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, statusError(http.MethodGet, path, resp)
+	}
+	return resp, nil
+}
+
+// post sends a script and returns the parse errors reported by the server.
+func (c *client) post(script string) ([]lang.ParseError, error) {
+	req, err := http.NewRequest(http.MethodPost, c.base+"/", strings.NewReader(script))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	return c.do(req)
+}
+
+func (c *client) do(req *http.Request) ([]lang.ParseError, error) {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil, nil
+	}
+
+	var body struct {
+		Errors []lang.ParseError `json:"errors"`
+	}
+	if resp.StatusCode != http.StatusBadRequest {
+		return nil, statusError(req.Method, req.URL.Path, resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return body.Errors, nil
+}
+
+// maxErrorBody bounds how much of an error response is shown to the user.
+const maxErrorBody = 1 << 10
+
+// statusError describes a failed response with the message the server gave
+// in its body, such as why a token was rejected or a script was too large.
+func statusError(method, path string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, msg)
+	}
+	return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+}
+
+// report returns a function that prints the parse errors of the named script
+// and turns them into errFailed.
+func report(name, script string) func([]lang.ParseError, error) error {
+	return func(errs []lang.ParseError, err error) error {
+		if err != nil {
+			return err
+		}
+		if len(errs) > 0 {
+			printErrors(os.Stderr, name, script, errs)
+			return errFailed
+		}
+		return nil
+	}
+}
+
+// printErrors writes errors in the file:line:column form followed by the
+// offending source line and a caret under the reported column.
+func printErrors(w io.Writer, name, script string, errs []lang.ParseError) {
+	lines := strings.Split(script, "\n")
+	for _, e := range errs {
+		msg := e.Message
+		if e.Command != "" {
+			msg = e.Command + ": " + msg
+		}
+		if e.Line <= 0 || e.Line > len(lines) {
+			fmt.Fprintf(w, "%s: %s\n", name, msg)
+			continue
+		}
+		fmt.Fprintf(w, "%s:%d:%d: %s\n", name, e.Line, e.Column, msg)
+		src := strings.ReplaceAll(lines[e.Line-1], "\t", " ")
+		fmt.Fprintf(w, "    %s\n    %s^\n", src, strings.Repeat(" ", max(e.Column-1, 0)))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+func TestPrintErrors(t *testing.T) {
+	script := "white\n\tfigure a 10\nfoo"
+	var out bytes.Buffer
+	printErrors(&out, "s.txt", script, []lang.ParseError{
+		{Line: 2, Column: 9, Command: "figure", Message: "undefined variable: a"},
+		{Line: 3, Column: 1, Message: "unknown command: foo"},
+		{Message: "script has too many lines"},
+	})
+	want := "s.txt:2:9: figure: undefined variable: a\n" +
+		"     figure a 10\n" +
+		"            ^\n" +
+		"s.txt:3:1: unknown command: foo\n" +
+		"    foo\n" +
+		"    ^\n" +
+		"s.txt: script has too many lines\n"
+	if out.String() != want {
+		t.Errorf("printErrors() wrote\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestClient_ShowsErrorBodies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			rw.Header().Set("Retry-After", "1")
+			http.Error(rw, "too many commands, slow down", http.StatusTooManyRequests)
+		default:
+			http.Error(rw, "missing bearer token", http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+	c := &client{base: srv.URL, http: srv.Client()}
+
+	if _, err := c.post("white"); err == nil || !strings.Contains(err.Error(), "429 Too Many Requests: too many commands, slow down") {
+		t.Errorf("post() = %v, want the reason from the body", err)
+	}
+	if _, err := c.get("/scene"); err == nil || !strings.Contains(err.Error(), "401 Unauthorized: missing bearer token") {
+		t.Errorf("get() = %v, want the reason from the body", err)
+	}
+}
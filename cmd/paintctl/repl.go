@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// keywords are offered for completion of the first word of a line.
+var keywords = []string{
+	"white", "green", "update", "bgrect", "figure", "move", "border", "reset",
+	"circle", "ellipse", "line", "polyline", "polygon", "moveshape", "text", "sprite",
+	"let", "repeat", "for", "help", "quit",
+}
+
+const replHelp = `Type painter commands to send them to the server, e.g. "figure 400 400".
+Blocks opened with "{" are sent once they are closed. Variables set with
+"let" stay defined for the rest of the session.
+Tab completes commands, the arrow keys browse the history. "quit" exits.
+`
+
+// lineReader is the part of term.Terminal the REPL needs, so that it can
+// also run on a plain pipe.
+type lineReader interface {
+	ReadLine() (string, error)
+	SetPrompt(prompt string)
+}
+
+func replCmd(c *client) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return repl(c, &pipeReader{scanner: bufio.NewScanner(os.Stdin)}, os.Stdout)
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "")
+	t.AutoCompleteCallback = complete
+	if h := loadHistory(); h != nil {
+		t.History = h
+		defer h.close()
+	}
+	if w, h, err := term.GetSize(fd); err == nil {
+		_ = t.SetSize(w, h)
+	}
+	return repl(c, t, t)
+}
+
+func repl(c *client, in lineReader, out io.Writer) error {
+	fmt.Fprint(out, replHelp)
+
+	var (
+		prelude []string
+		block   []string
+		depth   int
+	)
+	for {
+		if depth > 0 {
+			in.SetPrompt(".. ")
+		} else {
+			in.SetPrompt("paint> ")
+		}
+		line, err := in.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		trimmed := strings.TrimSpace(line)
+
+		if depth == 0 {
+			switch trimmed {
+			case "":
+				continue
+			case "quit", "exit":
+				return nil
+			case "help":
+				fmt.Fprint(out, replHelp)
+				continue
+			}
+		}
+
+		block = append(block, line)
+		if strings.HasSuffix(trimmed, "{") {
+			depth++
+		} else if trimmed == "}" && depth > 0 {
+			depth--
+		}
+		if depth > 0 {
+			continue
+		}
+
+		// Earlier let statements are resent with every command so that the
+		// server sees the variables they define.
+		errs, err := c.post(strings.Join(slices.Concat(prelude, block), "\n"))
+		switch {
+		case err != nil:
+			fmt.Fprintln(out, "error:", err)
+		case len(errs) > 0:
+			for i := range errs {
+				errs[i].Line -= len(prelude)
+			}
+			printErrors(out, "<repl>", strings.Join(block, "\n"), errs)
+		case strings.HasPrefix(strings.ToLower(trimmed), "let "):
+			prelude = append(prelude, line)
+		}
+		block = block[:0]
+	}
+}
+
+func complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || strings.ContainsAny(line[:pos], " \t") {
+		return "", 0, false
+	}
+	prefix := strings.ToLower(line[:pos])
+	var matches []string
+	for _, kw := range keywords {
+		if strings.HasPrefix(kw, prefix) {
+			matches = append(matches, kw)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	sort.Strings(matches)
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 && !strings.HasPrefix(line[pos:], " ") {
+		common += " "
+	}
+	return common + line[pos:], len(common), true
+}
+
+type pipeReader struct {
+	scanner *bufio.Scanner
+}
+
+func (p *pipeReader) ReadLine() (string, error) {
+	if !p.scanner.Scan() {
+		if err := p.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return p.scanner.Text(), nil
+}
+
+func (p *pipeReader) SetPrompt(string) {}
+
+// maxHistory bounds the number of lines kept in the history file.
+const maxHistory = 500
+
+// fileHistory is a term.History that persists entries in
+// ~/.paintctl_history.
+type fileHistory struct {
+	path    string
+	entries []string
+}
+
+func loadHistory() *fileHistory {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	h := &fileHistory{path: filepath.Join(home, ".paintctl_history")}
+	if data, err := os.ReadFile(h.path); err == nil {
+		for _, l := range strings.Split(string(data), "\n") {
+			if l != "" {
+				h.Add(l)
+			}
+		}
+	}
+	return h
+}
+
+func (h *fileHistory) Add(entry string) {
+	if strings.TrimSpace(entry) == "" {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > maxHistory {
+		h.entries = h.entries[len(h.entries)-maxHistory:]
+	}
+}
+
+func (h *fileHistory) Len() int { return len(h.entries) }
+
+func (h *fileHistory) At(idx int) string { return h.entries[len(h.entries)-1-idx] }
+
+func (h *fileHistory) close() {
+	_ = os.WriteFile(h.path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600)
+}
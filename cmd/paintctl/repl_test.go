@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRepl(t *testing.T) {
+	var scripts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		script, _ := io.ReadAll(r.Body)
+		scripts = append(scripts, string(script))
+		if strings.Contains(string(script), "move y") {
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusBadRequest)
+			_, _ = rw.Write([]byte(`{"errors": [{"line": 2, "column": 6, "command": "move", "message": "undefined variable: y"}]}`))
+		}
+	}))
+	defer srv.Close()
+	c := &client{base: srv.URL, http: srv.Client()}
+
+	in := &pipeReader{scanner: bufio.NewScanner(strings.NewReader("let x = 5\nrepeat 2 {\n  move x 0\n}\nmove y 0\nquit\nwhite\n"))}
+	var out bytes.Buffer
+	if err := repl(c, in, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"let x = 5", "let x = 5\nrepeat 2 {\n  move x 0\n}", "let x = 5\nmove y 0"}
+	if !slices.Equal(scripts, want) {
+		t.Errorf("sent %q, want %q", scripts, want)
+	}
+	// Lines of errors are counted from the command, not from the resent
+	// let statements.
+	if !strings.Contains(out.String(), "<repl>:1:6: move: undefined variable: y\n    move y 0\n         ^\n") {
+		t.Errorf("output = %q, want the error on line 1", out.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		line    string
+		pos     int
+		key     rune
+		want    string
+		wantPos int
+		ok      bool
+	}{
+		{"fig", 3, '\t', "figure ", 7, true},
+		{"FI", 2, '\t', "figure ", 7, true},
+		{"re", 2, '\t', "re", 2, true},
+		{"rep", 3, '\t', "repeat ", 7, true},
+		{"poly", 4, '\t', "poly", 4, true},
+		{"polyg", 5, '\t', "polygon ", 8, true},
+		{"ci", 2, '\t', "circle ", 7, true},
+		{"te", 2, '\t', "text ", 5, true},
+		{"sp", 2, '\t', "sprite ", 7, true},
+		{"w 1", 1, '\t', "white 1", 5, true},
+		{"zz", 2, '\t', "", 0, false},
+		{"figure 1", 8, '\t', "", 0, false},
+		{"fig", 3, 'x', "", 0, false},
+	}
+	for _, tt := range tests {
+		got, pos, ok := complete(tt.line, tt.pos, tt.key)
+		if got != tt.want || pos != tt.wantPos || ok != tt.ok {
+			t.Errorf("complete(%q, %d) = %q, %d, %v, want %q, %d, %v", tt.line, tt.pos, got, pos, ok, tt.want, tt.wantPos, tt.ok)
+		}
+	}
+}
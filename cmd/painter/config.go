@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+// Every setting is a flag. Settings not given on the command line are taken
+// from PAINTER_* environment variables, then from the config file, and keep
+// their defaults otherwise.
+var (
+	configFile  = flag.String("config", "", "TOML or JSON config file (env PAINTER_CONFIG)")
+	printConfig = flag.Bool("print-config", false, "print the effective configuration as TOML and exit")
+
+	addr        = flag.String("addr", "localhost:17000", "HTTP listen address")
+	title       = flag.String("title", "Simple painter", "window title")
+	width       = flag.Int("width", painter.DefaultSize.X, "canvas width in pixels")
+	height      = flag.Int("height", painter.DefaultSize.Y, "canvas height in pixels")
+	background  = flag.String("background", "#008000", "initial background colour")
+	figureSize  = flag.Int("figure-size", 200, "size of the initial figure in the centre, 0 for none")
+	figureColor = flag.String("figure-color", "yellow", "colour of the initial figure")
+)
+
+// notConfigurable are the flags that only make sense on the command line.
+var notConfigurable = map[string]bool{"config": true, "print-config": true}
+
+// envName returns the environment variable for a flag, e.g. PAINTER_MAX_BODY
+// for max-body.
+func envName(flagName string) string {
+	return "PAINTER_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// configure sets the flags of fs that were not given on the command line
+// from the environment and the config file, and returns where each value
+// came from.
+func configure(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) (map[string]string, error) {
+	sources := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) { sources[f.Name] = "default" })
+	fs.Visit(func(f *flag.Flag) { sources[f.Name] = "flag" })
+
+	path := fs.Lookup("config").Value.String()
+	if v, ok := lookupEnv(envName("config")); ok && sources["config"] != "flag" {
+		path, sources["config"] = v, "env "+envName("config")
+		_ = fs.Set("config", v)
+	}
+	file := map[string]any{}
+	if path != "" {
+		var err error
+		if file, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if notConfigurable[f.Name] {
+			return
+		}
+		v, inFile := file[f.Name]
+		delete(file, f.Name)
+		if sources[f.Name] == "flag" {
+			return
+		}
+		if env, ok := lookupEnv(envName(f.Name)); ok {
+			if err := fs.Set(f.Name, env); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", envName(f.Name), err))
+			}
+			sources[f.Name] = "env " + envName(f.Name)
+			return
+		}
+		if inFile {
+			if err := fs.Set(f.Name, fmt.Sprint(v)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", path, f.Name, err))
+			}
+			sources[f.Name] = path
+		}
+	})
+	for key := range file {
+		errs = append(errs, fmt.Errorf("%s: unknown setting %q", path, key))
+	}
+	return sources, errors.Join(errs...)
+}
+
+// readConfigFile reads a flat table of settings named like the flags. Files
+// ending in .json are read as JSON and all others as TOML.
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]any{}
+	if filepath.Ext(path) == ".json" {
+		d := json.NewDecoder(strings.NewReader(string(data)))
+		// Keep large integers such as max-body out of float notation.
+		d.UseNumber()
+		err = d.Decode(&settings)
+	} else {
+		err = toml.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for key, v := range settings {
+		switch v.(type) {
+		case map[string]any, []any, []map[string]any:
+			return nil, fmt.Errorf("%s: %s must be a single value", path, key)
+		}
+	}
+	return settings, nil
+}
+
+// writeConfig prints the configurable flags of fs as TOML that can be used
+// as a config file, noting where each value came from.
+func writeConfig(w io.Writer, fs *flag.FlagSet, sources map[string]string) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if notConfigurable[f.Name] {
+			return
+		}
+		var value string
+		switch v := f.Value.(flag.Getter).Get().(type) {
+		case string:
+			value = strconv.Quote(v)
+		case time.Duration:
+			value = strconv.Quote(v.String())
+		default:
+			value = f.Value.String()
+		}
+		fmt.Fprintf(w, "%s = %s # %s\n", f.Name, value, sources[f.Name])
+	})
+}
+
+// canvasConfig returns the canvas size and the scene canvases start with.
+func canvasConfig() (image.Point, painter.Scene, error) {
+	size := image.Pt(*width, *height)
+	if size.X <= 0 || size.Y <= 0 {
+		return size, painter.Scene{}, fmt.Errorf("invalid canvas size %dx%d", size.X, size.Y)
+	}
+	bg, err := lang.ParseColor(*background)
+	if err != nil {
+		return size, painter.Scene{}, fmt.Errorf("background: %w", err)
+	}
+	scene := painter.Scene{Background: bg}
+	if *figureSize > 0 {
+		c, err := lang.ParseColor(*figureColor)
+		if err != nil {
+			return size, painter.Scene{}, fmt.Errorf("figure-color: %w", err)
+		}
+		scene.Figures = []painter.DrawT180{{PosX: size.X / 2, PosY: size.Y / 2, Size: *figureSize, Color: c}}
+	}
+	return size, scene, nil
+}
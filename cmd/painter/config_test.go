@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigure(t *testing.T) {
+	dir := t.TempDir()
+	toml := filepath.Join(dir, "painter.toml")
+	if err := os.WriteFile(toml, []byte("addr = \"file:1\"\ntitle = \"file\"\nwidth = 300\ntimeout = \"3s\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	js := filepath.Join(dir, "painter.json")
+	if err := os.WriteFile(js, []byte(`{"title": "json", "max-body": 3000000}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	newFlags := func() *flag.FlagSet {
+		fs := flag.NewFlagSet("painter", flag.ContinueOnError)
+		fs.String("config", "", "")
+		fs.String("addr", "localhost:17000", "")
+		fs.String("title", "Simple painter", "")
+		fs.Int("width", 800, "")
+		fs.Int64("max-body", 1<<20, "")
+		fs.Duration("timeout", time.Second, "")
+		return fs
+	}
+	env := func(vars map[string]string) func(string) (string, bool) {
+		return func(name string) (string, bool) {
+			v, ok := vars[name]
+			return v, ok
+		}
+	}
+
+	fs := newFlags()
+	if err := fs.Parse([]string{"-config", toml, "-title", "flag"}); err != nil {
+		t.Fatal(err)
+	}
+	sources, err := configure(fs, env(map[string]string{"PAINTER_TITLE": "env", "PAINTER_WIDTH": "400"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"title":   "flag",
+		"width":   "400",
+		"addr":    "file:1",
+		"timeout": "3s",
+	} {
+		if got := fs.Lookup(name).Value.String(); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if sources["title"] != "flag" || sources["width"] != "env PAINTER_WIDTH" || sources["addr"] != toml || sources["max-body"] != "default" {
+		t.Errorf("sources = %v", sources)
+	}
+
+	var out strings.Builder
+	writeConfig(&out, fs, sources)
+	for _, line := range []string{`title = "flag" # flag`, `timeout = "3s" # ` + toml, "width = 400 # env PAINTER_WIDTH"} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("printed config lacks %q:\n%s", line, out.String())
+		}
+	}
+
+	fs = newFlags()
+	if _, err := configure(fs, env(map[string]string{"PAINTER_CONFIG": js})); err != nil {
+		t.Fatal(err)
+	}
+	if got := fs.Lookup("max-body").Value.String(); got != "3000000" {
+		t.Errorf("max-body from JSON = %q, want %q", got, "3000000")
+	}
+
+	fs = newFlags()
+	if _, err := configure(fs, env(map[string]string{"PAINTER_WIDTH": "wide"})); err == nil {
+		t.Error("invalid PAINTER_WIDTH accepted")
+	}
+}
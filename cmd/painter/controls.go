@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/ui"
+)
+
+// backgrounds are cycled through from the keyboard.
+var backgrounds = []color.RGBA{
+	{0, 128, 0, 255},
+	{255, 255, 255, 255},
+	{0, 0, 0, 255},
+	{0, 0, 128, 255},
+	{128, 128, 128, 255},
+}
+
+// controls turns window input into operations on the shown canvas.
+type controls struct {
+	canvases      *painter.Registry
+	screenshotDir string
+	// repaint redraws the window, e.g. to show the selection.
+	repaint func()
+
+	mu sync.Mutex
+	// selected is the index of the figure picked with the mouse, -1 if
+	// none. The keyboard moves the top figure when nothing is selected.
+	selected int
+	// shape is the ID of the shape picked with the mouse, if any. Shapes
+	// are drawn over the figures, so they are picked first.
+	shape string
+	// last is the position of the previous drag event.
+	last       image.Point
+	background int
+}
+
+// newFigureSize is the size of figures added with a right click.
+const newFigureSize = 100
+
+// resizeStep is the size change per mouse wheel step.
+const resizeStep = 10
+
+func (c *controls) post(ops ...painter.Operation) {
+	l, ok := c.canvases.Get(c.canvases.Shown())
+	if !ok {
+		return
+	}
+	for _, op := range ops {
+		l.Post(op)
+	}
+}
+
+func (c *controls) shown() (*painter.Loop, bool) {
+	return c.canvases.Get(c.canvases.Shown())
+}
+
+func (c *controls) selectFigure(i int) {
+	c.mu.Lock()
+	c.selected, c.shape = i, ""
+	c.mu.Unlock()
+}
+
+// press selects the shape or the figure under p, or clears the selection if
+// there is none.
+func (c *controls) press(p image.Point) {
+	l, ok := c.shown()
+	if !ok {
+		return
+	}
+	id, _ := l.ShapeAt(p)
+	i, ok := l.FigureAt(p)
+	if !ok || id != "" {
+		i = -1
+	}
+	c.mu.Lock()
+	c.selected, c.shape, c.last = i, id, p
+	c.mu.Unlock()
+	// Show or hide the highlight. The canvas has not changed, so there is
+	// no need for a new frame.
+	if c.repaint != nil {
+		c.repaint()
+	}
+}
+
+// drag moves the selection along with the mouse.
+func (c *controls) drag(p image.Point) {
+	c.mu.Lock()
+	i, id, d := c.selected, c.shape, p.Sub(c.last)
+	c.last = p
+	c.mu.Unlock()
+	switch {
+	case d == (image.Point{}):
+	case id != "":
+		c.post(painter.MoveShape{ID: id, By: d}, painter.UpdateOp)
+	case i >= 0:
+		c.post(painter.MoveFigure{Index: i, By: d}, painter.UpdateOp)
+	}
+}
+
+func (c *controls) release(p image.Point) {
+	c.drag(p)
+}
+
+// rightClick adds a figure at p and selects it once it is added, as other
+// operations may be queued before it.
+func (c *controls) rightClick(p image.Point) {
+	l, ok := c.shown()
+	if !ok {
+		return
+	}
+	l.Post(painter.AddFigure{
+		Figure: painter.DrawT180{PosX: p.X, PosY: p.Y, Size: newFigureSize, Color: color.RGBA{255, 255, 0, 255}},
+		Added:  c.selectFigure,
+	})
+	l.Post(painter.UpdateOp)
+}
+
+// wheel resizes the figure under p.
+func (c *controls) wheel(p image.Point, steps int) {
+	l, ok := c.shown()
+	if !ok {
+		return
+	}
+	if i, ok := l.FigureAt(p); ok {
+		l.Post(painter.ResizeFigure{Index: i, By: steps * resizeStep})
+		l.Post(painter.UpdateOp)
+	}
+}
+
+// selection returns the bounds of the selected shape or figure.
+func (c *controls) selection() (image.Rectangle, bool) {
+	c.mu.Lock()
+	i, id := c.selected, c.shape
+	c.mu.Unlock()
+	l, ok := c.shown()
+	if !ok {
+		return image.Rectangle{}, false
+	}
+	if id != "" {
+		for _, sh := range l.Scene().Shapes {
+			if sh.ID == id {
+				return sh.Bounds(), true
+			}
+		}
+		return image.Rectangle{}, false
+	}
+	if i < 0 {
+		return image.Rectangle{}, false
+	}
+	figures := l.Scene().Figures
+	if i >= len(figures) {
+		return image.Rectangle{}, false
+	}
+	return figures[i].Geometry().BoundsIn(image.Rectangle{Max: l.CanvasSize()}), true
+}
+
+// stats describes the shown canvas for the debug overlay.
+func (c *controls) stats() ui.HUDStats {
+	l, ok := c.shown()
+	if !ok {
+		return ui.HUDStats{}
+	}
+	st := l.Stats()
+	return ui.HUDStats{FrameSeq: st.FrameSeq, Queued: st.Queued, Figures: st.Figures, LastOp: st.LastOp}
+}
+
+func (c *controls) nudge(d image.Point) {
+	c.mu.Lock()
+	i, id := c.selected, c.shape
+	c.mu.Unlock()
+	if id != "" {
+		c.post(painter.MoveShape{ID: id, By: d}, painter.UpdateOp)
+		return
+	}
+	c.post(painter.MoveFigure{Index: i, By: d}, painter.UpdateOp)
+}
+
+func (c *controls) reset() {
+	c.selectFigure(-1)
+	c.post(painter.Reset{}, painter.UpdateOp)
+}
+
+func (c *controls) update() {
+	c.post(painter.UpdateOp)
+}
+
+func (c *controls) cycleBackground() {
+	c.mu.Lock()
+	c.background = (c.background + 1) % len(backgrounds)
+	bg := backgrounds[c.background]
+	c.mu.Unlock()
+	c.post(painter.FillBackground{Color: bg}, painter.UpdateOp)
+}
+
+func (c *controls) switchCanvas(forward bool) {
+	c.selectFigure(-1)
+	log.Printf("Showing canvas %s", c.canvases.ShowNext(forward))
+}
+
+// screenshot saves the last frame of the shown canvas as a PNG file.
+func (c *controls) screenshot() {
+	name := c.canvases.Shown()
+	l, ok := c.canvases.Get(name)
+	if !ok {
+		return
+	}
+	img, seq := l.Frame()
+	path := filepath.Join(c.screenshotDir, fmt.Sprintf("painter-%s-%s-%d.png", name, time.Now().Format("20060102-150405"), seq))
+	if err := writePNG(path, img); err != nil {
+		log.Printf("Cannot save screenshot: %s", err)
+		return
+	}
+	log.Printf("Saved screenshot %s", path)
+}
+
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
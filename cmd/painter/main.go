@@ -1,35 +1,203 @@
 package main
 
 import (
-	"image"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/roman-mazur/architecture-lab-3/painter"
 	"github.com/roman-mazur/architecture-lab-3/painter/lang"
 	"github.com/roman-mazur/architecture-lab-3/ui"
 )
 
+var (
+	unixSocket  = flag.String("unix", "", "path of a Unix socket to accept line-protocol commands on")
+	tcpAddr     = flag.String("tcp", "", "address of a raw TCP port to accept line-protocol commands on")
+	maxCanvases = flag.Int("max-canvases", 16, "maximum number of named canvases, 0 for no limit")
+	canvas      = flag.String("canvas", painter.DefaultCanvas, "canvas shown in the window at startup")
+	tokensFile  = flag.String("tokens", "", "file with API tokens; the HTTP API is open to anyone if not set")
+	maxAssets   = flag.Int64("max-assets", 64<<20, "memory for uploaded sprite images in bytes, 0 for no limit")
+
+	maxBody      = flag.Int64("max-body", 1<<20, "largest accepted request body in bytes")
+	maxLines     = flag.Int("max-lines", 10000, "largest accepted number of lines in a script, and of operations it expands to")
+	rate         = flag.Float64("rate", lang.DefaultRate, "commands per second each client may post, 0 for no limit")
+	burst        = flag.Int("burst", lang.DefaultBurst, "commands each client may post in a burst")
+	readTimeout  = flag.Duration("read-timeout", 10*time.Second, "time limit for reading a request")
+	writeTimeout = flag.Duration("write-timeout", 10*time.Second, "time limit for writing a response")
+	idleTimeout  = flag.Duration("idle-timeout", 5*time.Minute, "time after which silent line-protocol connections are closed, 0 for never")
+
+	keys          = flag.String("keys", "", `key bindings replacing the defaults, e.g. "screenshot=ctrl+p,reset=shift+r"`)
+	screenshotDir = flag.String("screenshot-dir", ".", "directory for screenshots saved from the window")
+	debug         = flag.Bool("debug", false, "log window events and show the debug overlay (F3 toggles it)")
+	fontFile      = flag.String("font", "", "OpenType or TrueType font for texts; basicfont if not set")
+
+	initScript = flag.String("init", "", "script drawing the initial scene of the default canvas")
+	watch      = flag.Bool("watch", false, "run the -init script again whenever the file changes")
+)
+
 func main() {
+	flag.Parse()
+	sources, err := configure(flag.CommandLine, os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "painter:", err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		writeConfig(os.Stdout, flag.CommandLine, sources)
+		return
+	}
+	size, initial, err := canvasConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "painter:", err)
+		os.Exit(2)
+	}
+
+	if *fontFile != "" {
+		if err := painter.LoadFont(*fontFile); err != nil {
+			fmt.Fprintln(os.Stderr, "painter:", err)
+			os.Exit(2)
+		}
+	}
+
 	var (
 		pv     ui.Visualizer
-		opLoop painter.Loop
-		parser lang.Parser
+		tokens *lang.Tokens
 	)
+	parser := lang.Parser{Size: size, MaxLines: *maxLines}
+	limiter := &lang.Limiter{MaxBody: *maxBody, Rate: *rate, Burst: *burst}
+	if *tokensFile != "" {
+		var err error
+		if tokens, err = lang.LoadTokens(*tokensFile); err != nil {
+			log.Fatalf("Cannot load tokens: %s", err)
+		}
+		log.Printf("Loaded %d API tokens", tokens.Len())
+	}
+	assets := &painter.Assets{Max: *maxAssets}
+	canvases := &painter.Registry{Receiver: &pv, Max: *maxCanvases, Size: size, Initial: &initial, Assets: assets}
+	opLoop := canvases.Default()
+	if *canvas != painter.DefaultCanvas {
+		if _, err := canvases.GetOrCreate(*canvas); err != nil {
+			log.Fatalf("Cannot create canvas %s: %s", *canvas, err)
+		}
+		_ = canvases.Show(*canvas)
+	}
+
+	if *initScript != "" {
+		if err := runScript(opLoop, &parser, *initScript); err != nil {
+			fmt.Fprintf(os.Stderr, "painter: %s:\n%s\n", *initScript, err)
+			os.Exit(1)
+		}
+	}
+	if *watch {
+		if *initScript == "" {
+			fmt.Fprintln(os.Stderr, "painter: -watch requires -init")
+			os.Exit(2)
+		}
+		stopWatch := make(chan struct{})
+		defer close(stopWatch)
+		watchScript(opLoop, &parser, *initScript, 500*time.Millisecond, stopWatch)
+	}
 
-	pv.Title = "Simple painter"
-	pv.OnScreenReady = opLoop.Start
-	opLoop.Receiver = &pv
+	pv.Title = *title
+	pv.Size = size
+	pv.OnScreenReady = canvases.Start
 
-	pv.OnMove = func(p image.Point) {
-		opLoop.Post(painter.Move{NewPos: p})
-		opLoop.Post(painter.UpdateOp)
+	pv.Keys = ui.DefaultKeymap()
+	if *keys != "" {
+		if err := pv.Keys.Bind(*keys); err != nil {
+			fmt.Fprintln(os.Stderr, "painter: keys:", err)
+			os.Exit(2)
+		}
 	}
+	ctl := &controls{canvases: canvases, screenshotDir: *screenshotDir, repaint: pv.Repaint, selected: -1}
+	pv.OnPress = ctl.press
+	pv.OnDrag = ctl.drag
+	pv.OnRelease = ctl.release
+	pv.OnRightClick = ctl.rightClick
+	pv.OnWheel = ctl.wheel
+	pv.Selection = ctl.selection
+	pv.Debug = *debug
+	pv.Stats = ctl.stats
+	pv.OnSwitchCanvas = ctl.switchCanvas
+	pv.OnNudge = ctl.nudge
+	pv.OnReset = ctl.reset
+	pv.OnUpdate = ctl.update
+	pv.OnScreenshot = ctl.screenshot
+	pv.OnCycleBackground = ctl.cycleBackground
 
 	go func() {
-		http.Handle("/", lang.HttpHandler(&opLoop, &parser))
-		_ = http.ListenAndServe("localhost:17000", nil)
+		canvasHandler := lang.CanvasHandler(canvases, &parser)
+		http.Handle("/", lang.HttpHandler(opLoop, &parser))
+		http.Handle("/schema.json", lang.SchemaHandler())
+		http.Handle("/frame.png", lang.FrameHandler(opLoop))
+		http.Handle("/scene", lang.SceneHandler(opLoop))
+		http.Handle("/events", lang.EventsHandler(opLoop))
+		http.Handle("/canvases", canvasHandler)
+		http.Handle("/canvases/", canvasHandler)
+		http.Handle("/c/", canvasHandler)
+		assetsHandler := lang.AssetsHandler(assets)
+		http.Handle("/assets", assetsHandler)
+		http.Handle("/assets/", assetsHandler)
+		server := &http.Server{
+			Addr:              *addr,
+			Handler:           tokens.Authenticate(limiter.Limit(http.DefaultServeMux)),
+			ReadHeaderTimeout: *readTimeout,
+			ReadTimeout:       *readTimeout,
+			WriteTimeout:      *writeTimeout,
+		}
+		if err := server.ListenAndServe(); err != nil {
+			log.Fatalf("HTTP server stopped: %s", err)
+		}
 	}()
 
+	lines := &lang.LineServer{Loop: opLoop, Parser: &parser, Tokens: tokens, Limiter: limiter, IdleTimeout: *idleTimeout}
+	if *unixSocket != "" {
+		if err := removeStaleSocket(*unixSocket); err != nil {
+			log.Fatalf("Cannot listen on unix %s: %s", *unixSocket, err)
+		}
+		l := listen("unix", *unixSocket, lines)
+		defer l.Close()
+	}
+	if *tcpAddr != "" {
+		l := listen("tcp", *tcpAddr, lines)
+		defer l.Close()
+	}
+
 	pv.Main()
-	opLoop.StopAndWait()
+	canvases.StopAndWait()
+}
+
+// removeStaleSocket removes a socket file left behind by a previous run,
+// which would make Listen fail. Any other file at path is left alone.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	return os.Remove(path)
+}
+
+func listen(network, addr string, s *lang.LineServer) net.Listener {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		log.Fatalf("Cannot listen on %s %s: %s", network, addr, err)
+	}
+	log.Printf("Accepting line-protocol commands on %s %s", network, addr)
+	go func() {
+		if err := s.Serve(l); err != nil {
+			log.Printf("Line listener %s %s stopped: %s", network, addr, err)
+		}
+	}()
+	return l
 }
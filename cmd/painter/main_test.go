@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir := t.TempDir()
+	if err := removeStaleSocket(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("removeStaleSocket() of a missing file = %v", err)
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, []byte("keep me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(file); err == nil {
+		t.Error("removeStaleSocket() of a regular file succeeded")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("regular file was removed: %v", err)
+	}
+
+	sock := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("cannot listen on a Unix socket: %s", err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if err := removeStaleSocket(sock); err != nil {
+		t.Errorf("removeStaleSocket() of a socket = %v", err)
+	}
+	if _, err := os.Lstat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket was not removed: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+// runScript parses the script at path and, if it is valid, replaces the
+// scene of loop with the one the script draws. The scene is left alone if
+// the script has errors.
+func runScript(loop *painter.Loop, p *lang.Parser, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ops, err := p.Parse(f)
+	if err != nil {
+		return err
+	}
+	// One list, so that commands from other clients do not end up in the
+	// middle of the script.
+	list := append(painter.OperationList{painter.Reset{}}, ops...)
+	loop.Post(append(list, painter.UpdateOp))
+	return nil
+}
+
+// watchScript starts running the script at path again every time the file
+// changes from now on, until stop is closed. The file is polled, which also
+// notices editors that replace the file instead of writing it in place.
+func watchScript(loop *painter.Loop, p *lang.Parser, path string, interval time.Duration, stop <-chan struct{}) {
+	last, _ := os.Stat(path)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			fi, err := os.Stat(path)
+			if err != nil || (last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size()) {
+				continue
+			}
+			last = fi
+			if err := runScript(loop, p, path); err != nil {
+				log.Printf("Keeping the last good scene, %s has errors:\n%s", path, err)
+				continue
+			}
+			log.Printf("Reloaded %s", path)
+		}
+	}()
+}
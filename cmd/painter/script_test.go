@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+func TestWatchScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "init.txt")
+	write := func(script string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	figures := func(l *painter.Loop, want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for len(l.Scene().Figures) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("figures = %d, want %d", len(l.Scene().Figures), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	loop := &painter.Loop{}
+	parser := &lang.Parser{}
+	write("white\nfigure 100 100\n")
+	if err := runScript(loop, parser, path); err != nil {
+		t.Fatal(err)
+	}
+	loop.Start(nil)
+	defer loop.StopAndWait()
+	// The script replaces the built-in figure.
+	figures(loop, 1)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	watchScript(loop, parser, path, 10*time.Millisecond, stop)
+
+	write("figure 1 1\nfigure 2 2\nfigure 3 3\n")
+	figures(loop, 3)
+
+	write("figure 1\n")
+	time.Sleep(100 * time.Millisecond)
+	figures(loop, 3)
+
+	write("figure 1 1\nfigure 2 2\n")
+	figures(loop, 2)
+}
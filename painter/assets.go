@@ -0,0 +1,153 @@
+package painter
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrAssetNotFound = errors.New("asset not found")
+	ErrAssetsFull    = errors.New("asset memory limit reached")
+	ErrAssetName     = errors.New("invalid asset name")
+	ErrAssetTooLarge = errors.New("image is too large")
+)
+
+// MaxAssetPixels bounds the size of every image, even when Assets have no
+// memory limit, so that the header of a small file cannot make the server
+// decode a huge image.
+const MaxAssetPixels = 4096 * 4096
+
+// CheckAssetSize returns ErrAssetTooLarge for images of more than
+// MaxAssetPixels pixels.
+func CheckAssetSize(size image.Point) error {
+	if int64(size.X)*int64(size.Y) > MaxAssetPixels {
+		return fmt.Errorf("%w: %dx%d is more than %d pixels", ErrAssetTooLarge, size.X, size.Y, MaxAssetPixels)
+	}
+	return nil
+}
+
+var assetName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Assets holds the images sprites are drawn from. Canvases share them, and
+// scenes refer to them by name, so that replacing an image changes every
+// sprite drawn from it on the next update. Stored images are never changed.
+type Assets struct {
+	// Max limits the memory taken by the images, 4 bytes per pixel. Zero
+	// means no limit.
+	Max int64
+
+	mu   sync.RWMutex
+	imgs map[string]*image.RGBA
+	used int64
+}
+
+// imageBytes is the memory an image of the given size takes.
+func imageBytes(size image.Point) int64 {
+	return 4 * int64(size.X) * int64(size.Y)
+}
+
+// Fits reports whether an image of the given size can be stored under name
+// without going over Max.
+func (a *Assets) Fits(name string, size image.Point) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.fitsLocked(name, size)
+}
+
+func (a *Assets) fitsLocked(name string, size image.Point) bool {
+	if a.Max <= 0 {
+		return true
+	}
+	var old int64
+	if img, ok := a.imgs[name]; ok {
+		old = imageBytes(img.Rect.Size())
+	}
+	return a.used-old+imageBytes(size) <= a.Max
+}
+
+// Put stores img under name, replacing the image stored there before.
+func (a *Assets) Put(name string, img image.Image) error {
+	if !assetName.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrAssetName, name)
+	}
+	b := img.Bounds()
+	if err := CheckAssetSize(b.Size()); err != nil {
+		return err
+	}
+	rgba := image.NewRGBA(image.Rectangle{Max: b.Size()})
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.fitsLocked(name, b.Size()) {
+		return fmt.Errorf("%w: %s needs %d bytes, %d of %d are used", ErrAssetsFull, name, imageBytes(b.Size()), a.used, a.Max)
+	}
+	if a.imgs == nil {
+		a.imgs = map[string]*image.RGBA{}
+	}
+	if old, ok := a.imgs[name]; ok {
+		a.used -= imageBytes(old.Rect.Size())
+	}
+	a.imgs[name] = rgba
+	a.used += imageBytes(b.Size())
+	return nil
+}
+
+// Get returns the image stored under name. It starts at (0, 0) and must not
+// be changed.
+func (a *Assets) Get(name string) (*image.RGBA, bool) {
+	if a == nil {
+		return nil, false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	img, ok := a.imgs[name]
+	return img, ok
+}
+
+// Delete removes the image stored under name.
+func (a *Assets) Delete(name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	img, ok := a.imgs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAssetNotFound, name)
+	}
+	a.used -= imageBytes(img.Rect.Size())
+	delete(a.imgs, name)
+	return nil
+}
+
+// Names returns the names of the stored images in order.
+func (a *Assets) Names() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	names := make([]string, 0, len(a.imgs))
+	for name := range a.imgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Used returns the memory taken by the stored images.
+func (a *Assets) Used() int64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.used
+}
+
+// spriteRect returns where the sprite goes if its image is of the given
+// size.
+func (s Shape) spriteRect(natural image.Point) image.Rectangle {
+	size := image.Pt(s.W, s.H)
+	if size == (image.Point{}) {
+		size = natural
+	}
+	return image.Rectangle{Min: s.Points[0], Max: s.Points[0].Add(size)}
+}
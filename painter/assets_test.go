@@ -0,0 +1,118 @@
+package painter
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// checker returns a w by h image of red and transparent squares, with its
+// bounds not at the origin.
+func checker(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(10, 10, 10+w, 10+h))
+	for y := range h {
+		for x := range w {
+			if (x+y)%2 == 0 {
+				img.SetNRGBA(10+x, 10+y, color.NRGBA{255, 0, 0, 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestAssets(t *testing.T) {
+	a := Assets{Max: 4 * 100}
+	if err := a.Put("a", checker(5, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Put("b", checker(10, 10)); !errors.Is(err, ErrAssetsFull) {
+		t.Errorf("Put() over the limit = %v, want ErrAssetsFull", err)
+	}
+	// Replacing an image frees its memory first.
+	if err := a.Put("a", checker(10, 10)); err != nil {
+		t.Errorf("Put() replacing a = %v", err)
+	}
+	if err := a.Put("../a", checker(1, 1)); !errors.Is(err, ErrAssetName) {
+		t.Errorf("Put() with a bad name = %v, want ErrAssetName", err)
+	}
+	if err := (&Assets{}).Put("huge", image.NewUniform(color.White)); !errors.Is(err, ErrAssetTooLarge) {
+		t.Errorf("Put() of a huge image = %v, want ErrAssetTooLarge", err)
+	}
+	if img, ok := a.Get("a"); !ok || img.Rect != image.Rect(0, 0, 10, 10) || img.RGBAAt(0, 0) != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("Get() = %v, %v, want the 10x10 image moved to the origin", img, ok)
+	}
+	if a.Used() != 400 || a.Fits("b", image.Pt(1, 1)) || !a.Fits("a", image.Pt(5, 5)) {
+		t.Errorf("Used() = %d", a.Used())
+	}
+	if err := a.Delete("a"); err != nil || a.Used() != 0 || len(a.Names()) != 0 {
+		t.Errorf("Delete() = %v, Used() = %d", err, a.Used())
+	}
+	if err := a.Delete("a"); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("Delete() of a missing asset = %v, want ErrAssetNotFound", err)
+	}
+}
+
+func TestLoop_Sprites(t *testing.T) {
+	assets := &Assets{}
+	if err := assets.Put("logo", checker(4, 4)); err != nil {
+		t.Fatal(err)
+	}
+	l := Loop{Assets: assets}
+	l.Start(nil)
+	l.Post(Reset{})
+	l.Post(FillBackground{Color: color.RGBA{0, 0, 255, 255}})
+	l.Post(DrawShape{Shape{ID: "s", Kind: Sprite, Asset: "logo", Points: []image.Point{{10, 10}}}})
+	l.Post(DrawShape{Shape{ID: "big", Kind: Sprite, Asset: "logo", Points: []image.Point{{100, 100}}, W: 40, H: 40}})
+	l.Post(DrawShape{Shape{ID: "gone", Kind: Sprite, Asset: "missing", Points: []image.Point{{200, 200}}}})
+	l.Post(MoveShape{ID: "s", By: image.Pt(5, 5)})
+	l.Post(UpdateOp)
+	l.StopAndWait()
+
+	s := l.Scene()
+	if sh := s.Shapes[0]; sh.W != 4 || sh.H != 4 || sh.Bounds() != image.Rect(15, 15, 19, 19) {
+		t.Errorf("sprite = %+v, want the size of its image at (15, 15)", sh)
+	}
+	if id, _ := l.ShapeAt(image.Pt(130, 130)); id != "big" {
+		t.Errorf("ShapeAt() = %q, want big", id)
+	}
+
+	img, _ := l.Frame()
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	for _, tt := range []struct {
+		p    image.Point
+		want color.RGBA
+	}{
+		// Transparent pixels of the sprite keep the background.
+		{image.Pt(15, 15), red},
+		{image.Pt(16, 15), blue},
+		// Scaled 10 times, the squares are only blended at their edges.
+		{image.Pt(105, 105), red},
+		{image.Pt(115, 105), blue},
+		{image.Pt(200, 200), blue},
+	} {
+		if got := img.RGBAAt(tt.p.X, tt.p.Y); !near(got, tt.want) {
+			t.Errorf("pixel at %v = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+
+	// Scenes refer to the images by name.
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Scene
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if sh := back.Shapes[1]; sh.Asset != "logo" || sh.W != 40 || back.Assets != nil {
+		t.Errorf("scene from JSON has sprite %+v", sh)
+	}
+}
+
+// near reports whether the channels of a and b differ by less than 32.
+func near(a, b color.RGBA) bool {
+	d := func(x, y uint8) bool { return max(x, y)-min(x, y) < 32 }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+}
@@ -0,0 +1,110 @@
+package painter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Blend is how the colours of an object mix with the colours under it.
+// Blend modes other than BlendNormal are only used when frames are
+// rendered; textures filled directly always draw over.
+type Blend string
+
+const (
+	// BlendNormal paints the object over what is under it. It is the same
+	// as the empty Blend.
+	BlendNormal Blend = "normal"
+	// BlendMultiply multiplies the colours, which only ever darkens them.
+	BlendMultiply Blend = "multiply"
+	// BlendScreen multiplies the inverted colours, which only ever
+	// lightens them.
+	BlendScreen Blend = "screen"
+)
+
+// CheckBlend reports unknown blend modes.
+func CheckBlend(b Blend) error {
+	switch b {
+	case "", BlendNormal, BlendMultiply, BlendScreen:
+		return nil
+	}
+	return fmt.Errorf("unknown blend mode %q", b)
+}
+
+// CheckOpacity reports opacities out of the (0, 1] range. Zero stands for
+// 1 in figures and shapes, so it cannot be used for invisible ones.
+func CheckOpacity(o float64) error {
+	if !(o > 0 && o <= 1) {
+		return fmt.Errorf("opacity must be more than 0 and at most 1, got %v", o)
+	}
+	return nil
+}
+
+// style is how an object is composited: its opacity, where zero stands for
+// 1, and its blend mode.
+type style struct {
+	opacity float64
+	blend   Blend
+}
+
+func (s style) normal() bool {
+	return s.blend == "" || s.blend == BlendNormal
+}
+
+// alpha returns the opacity as a factor for colours.
+func (s style) alpha() float64 {
+	if s.opacity == 0 {
+		return 1
+	}
+	return s.opacity
+}
+
+// fade returns c with the opacity applied.
+func (s style) fade(c color.Color) color.RGBA {
+	return scaleColor(color.RGBAModel.Convert(c).(color.RGBA), s.alpha())
+}
+
+// scaleColor multiplies the premultiplied c by f.
+func scaleColor(c color.RGBA, f float64) color.RGBA {
+	if f >= 1 {
+		return c
+	}
+	m := func(v uint8) uint8 { return uint8(math.Round(float64(v) * f)) }
+	return color.RGBA{m(c.R), m(c.G), m(c.B), m(c.A)}
+}
+
+// composite blends into img the colour src returns for each pixel of rect.
+// The colours are premultiplied and are mixed by the separable blend
+// formulas of the W3C Compositing and Blending spec.
+func composite(img *image.RGBA, rect image.Rectangle, blend Blend, src func(x, y int) color.RGBA) {
+	rect = rect.Intersect(img.Rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			s := src(x, y)
+			if s.A == 0 {
+				continue
+			}
+			img.SetRGBA(x, y, blendPixel(img.RGBAAt(x, y), s, blend))
+		}
+	}
+}
+
+// blendPixel blends the premultiplied colour s into b.
+func blendPixel(b, s color.RGBA, blend Blend) color.RGBA {
+	as, ab := float64(s.A)/255, float64(b.A)/255
+	mix := func(cs, cb uint8) uint8 {
+		s, b := float64(cs)/255, float64(cb)/255
+		var c float64
+		switch blend {
+		case BlendMultiply:
+			c = s*(1-ab) + b*(1-as) + s*b
+		case BlendScreen:
+			c = s + b - s*b
+		default:
+			c = s + b*(1-as)
+		}
+		return uint8(math.Round(min(max(c, 0), 1) * 255))
+	}
+	return color.RGBA{mix(s.R, b.R), mix(s.G, b.G), mix(s.B, b.B), uint8(math.Round((as + ab - as*ab) * 255))}
+}
@@ -0,0 +1,147 @@
+package painter
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScene_Blending(t *testing.T) {
+	gray := color.RGBA{128, 128, 128, 255}
+	orange := color.RGBA{255, 128, 0, 255}
+	square := func(x int, c color.RGBA, opacity float64, blend Blend) Shape {
+		return Shape{
+			Kind: Polygon, Points: []image.Point{{x, 0}, {x + 10, 0}, {x + 10, 10}, {x, 10}},
+			Fill: c, Opacity: opacity, Blend: blend,
+		}
+	}
+	s := Scene{Background: gray, Shapes: []Shape{
+		square(0, orange, 0, ""),
+		square(10, orange, 0.5, BlendNormal),
+		// A colour with alpha is the same as an opaque one with opacity.
+		square(20, color.RGBA{128, 64, 0, 128}, 0, ""),
+		square(30, orange, 0, BlendMultiply),
+		square(40, orange, 0, BlendScreen),
+		square(50, orange, 0.5, BlendMultiply),
+		square(60, orange, 0.5, BlendScreen),
+		// Half opaque squares overlapping each other.
+		square(70, orange, 0.5, ""),
+		square(75, orange, 0.5, ""),
+	}}
+	img := s.Render(image.Pt(100, 10))
+
+	// The normal mode is drawn by image/draw, whose Over rounds down: the
+	// blue of half orange over gray is 128 * 127/255 = 63.75.
+	for _, tt := range []struct {
+		name string
+		x    int
+		want color.RGBA
+	}{
+		{"opaque", 5, orange},
+		{"opacity", 15, color.RGBA{192, 128, 63, 255}},
+		{"alpha", 25, color.RGBA{192, 128, 63, 255}},
+		{"multiply", 35, color.RGBA{128, 64, 0, 255}},
+		{"screen", 45, color.RGBA{255, 192, 128, 255}},
+		{"multiply with opacity", 55, color.RGBA{128, 96, 64, 255}},
+		{"screen with opacity", 65, color.RGBA{192, 160, 128, 255}},
+		{"one half opaque square", 72, color.RGBA{192, 128, 63, 255}},
+		{"two half opaque squares", 77, color.RGBA{224, 128, 31, 255}},
+	} {
+		if got := img.RGBAAt(tt.x, 5); got != tt.want {
+			t.Errorf("%s: pixel = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScene_BlendingSprites(t *testing.T) {
+	assets := &Assets{}
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	if err := assets.Put("white", src); err != nil {
+		t.Fatal(err)
+	}
+	s := Scene{Background: color.RGBA{0, 0, 255, 255}, Assets: assets, Shapes: []Shape{
+		{Kind: Sprite, Asset: "white", Points: []image.Point{{0, 0}}, W: 4, H: 4, Opacity: 0.5},
+		{Kind: Sprite, Asset: "white", Points: []image.Point{{4, 0}}, Blend: BlendMultiply},
+		{Kind: Sprite, Asset: "white", Points: []image.Point{{6, 0}}, Blend: BlendScreen, Opacity: 0.5},
+	}}
+	img := s.Render(image.Pt(8, 4))
+	for _, tt := range []struct {
+		x    int
+		want color.RGBA
+	}{
+		{1, color.RGBA{128, 128, 255, 255}},
+		{4, color.RGBA{0, 0, 255, 255}},
+		{6, color.RGBA{128, 128, 255, 255}},
+	} {
+		if got := img.RGBAAt(tt.x, 1); got != tt.want {
+			t.Errorf("pixel at x = %d is %v, want %v", tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestScene_BigTranslucentSprite(t *testing.T) {
+	assets := &Assets{}
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	if err := assets.Put("white", src); err != nil {
+		t.Fatal(err)
+	}
+	// Scaling the whole sprite would take 160 GB.
+	s := Scene{Background: color.RGBA{0, 0, 255, 255}, Assets: assets, Shapes: []Shape{
+		{Kind: Sprite, Asset: "white", Points: []image.Point{{-100000, -100000}}, W: 200000, H: 200000, Opacity: 0.5},
+		{Kind: Sprite, Asset: "white", Points: []image.Point{{-100000, 4}}, W: 200000, H: 200000, Blend: BlendMultiply},
+	}}
+	img := s.Render(image.Pt(8, 8))
+	want := color.RGBA{128, 128, 255, 255}
+	for _, p := range []image.Point{{0, 0}, {7, 3}, {3, 4}, {7, 7}} {
+		if got := img.RGBAAt(p.X, p.Y); got != want {
+			t.Errorf("pixel at %v is %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestScene_DrawIsTranslucent(t *testing.T) {
+	// Textures cannot blend, but draw over with the opacity applied.
+	s := Scene{Background: color.RGBA{0, 0, 255, 255}, Figures: []DrawT180{
+		{PosX: 50, PosY: 50, Size: 100, Color: color.RGBA{255, 0, 0, 255}, Opacity: 0.5},
+	}}
+	tx := newMemTexture(image.Pt(100, 100))
+	s.draw(tx)
+	want := s.Render(image.Pt(100, 100)).RGBAAt(50, 50)
+	if got := tx.img.RGBAAt(50, 50); got != want || got.B == 0 {
+		t.Errorf("drawn pixel = %v, rendered %v", got, want)
+	}
+}
+
+func TestScene_JSONKeepsOpacity(t *testing.T) {
+	s := Scene{Figures: []DrawT180{{Size: 10, Color: color.RGBA{128, 0, 0, 128}, Opacity: 0.25, Blend: BlendScreen}}}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Colours are written with straight alpha, as in scripts.
+	if want := `"color":"#ff000080","opacity":0.25,"blend":"screen"`; !strings.Contains(string(data), want) {
+		t.Errorf("JSON = %s, want it to contain %s", data, want)
+	}
+	var back Scene
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back.Figures, s.Figures) {
+		t.Errorf("figures from JSON = %+v, want %+v", back.Figures, s.Figures)
+	}
+	for _, bad := range []string{`"opacity":2`, `"blend":"overlay"`} {
+		data := strings.Replace(`{"background":"#000000","figures":[{"x":0,"y":0,"size":10,"color":"#ff0000",X}]}`, "X", bad, 1)
+		if err := json.Unmarshal([]byte(data), &back); err == nil {
+			t.Errorf("Unmarshal() accepted %s", bad)
+		}
+	}
+}
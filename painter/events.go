@@ -0,0 +1,80 @@
+package painter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event reports an operation handled by the Loop.
+type Event struct {
+	Op    string    `json:"op"`
+	Frame uint64    `json:"frame"`
+	Time  time.Time `json:"time"`
+}
+
+type events struct {
+	mu     sync.Mutex
+	subs   map[chan Event]struct{}
+	closed bool
+}
+
+func (e *events) subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if e.subs == nil {
+		e.subs = make(map[chan Event]struct{})
+	}
+	e.subs[ch] = struct{}{}
+	e.mu.Unlock()
+
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.subs[ch]; ok {
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// close closes the channels of all subscribers, now and in the future.
+func (e *events) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs {
+		close(ch)
+	}
+	e.subs = nil
+	e.closed = true
+}
+
+func (e *events) publish(op Operation, frame uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.subs) == 0 {
+		return
+	}
+	ev := Event{Op: opName(op), Frame: frame, Time: time.Now()}
+	for ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// opName returns the type name of op without the package prefix.
+func opName(op Operation) string {
+	name := fmt.Sprintf("%T", op)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
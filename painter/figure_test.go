@@ -0,0 +1,152 @@
+package painter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter/geom"
+)
+
+func TestDrawT180_Styles(t *testing.T) {
+	yellow := color.RGBA{255, 255, 0, 255}
+	black := color.RGBA{0, 0, 0, 255}
+	bg := color.RGBA{0, 128, 0, 255}
+	render := func(f DrawT180) *image.RGBA {
+		f.PosX, f.PosY, f.Size, f.Color = 400, 400, 100, yellow
+		s := Scene{Background: bg, Figures: []DrawT180{f}}
+		return s.Render(DefaultSize)
+	}
+
+	// A full turn goes through the rasteriser and must match the rectangles.
+	plain, turned := render(DrawT180{}), render(DrawT180{Rotate: 360})
+	for y := 300; y < 500; y++ {
+		for x := 300; x < 500; x++ {
+			if a, b := plain.RGBAAt(x, y), turned.RGBAAt(x, y); a != b {
+				t.Fatalf("pixel (%d, %d): rasterised %v, rectangles %v", x, y, b, a)
+			}
+		}
+	}
+
+	tests := []struct {
+		name string
+		f    DrawT180
+		p    image.Point
+		want color.RGBA
+	}{
+		{"stem above the bar", DrawT180{}, image.Pt(400, 360), yellow},
+		{"nothing below the bar", DrawT180{}, image.Pt(400, 440), bg},
+		{"rotated by 180", DrawT180{Rotate: 180}, image.Pt(400, 440), yellow},
+		{"rotated by 180, old stem", DrawT180{Rotate: 180}, image.Pt(400, 360), bg},
+		{"rotated by 90", DrawT180{Rotate: 90}, image.Pt(440, 400), yellow},
+		{"rotated by 90, old bar end", DrawT180{Rotate: 90}, image.Pt(360, 400), bg},
+		{"outline", DrawT180{Outline: black, OutlineWidth: 4}, image.Pt(370, 388), black},
+		{"inside the outline", DrawT180{Outline: black, OutlineWidth: 4}, image.Pt(370, 395), yellow},
+		{"outline corner", DrawT180{Outline: black, OutlineWidth: 4}, image.Pt(348, 388), black},
+	}
+	for _, tt := range tests {
+		if got := render(tt.f).RGBAAt(tt.p.X, tt.p.Y); got != tt.want {
+			t.Errorf("%s: pixel at %v = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
+
+// TestDrawT180_RenderersAgree checks that the operation and the polygon
+// rasteriser draw exactly the pixels the geometry says the figure covers,
+// and that the anti-aliased scene renderer only blends the edges.
+func TestDrawT180_RenderersAgree(t *testing.T) {
+	yellow := color.RGBA{255, 255, 0, 255}
+	for _, f := range []DrawT180{
+		{PosX: 400, PosY: 400, Size: 100, Color: yellow},
+		{PosX: 123, PosY: 321, Size: 77, Color: yellow},
+		{PosX: 0, PosY: 0, Size: 60, Color: yellow},
+		{PosX: 300, PosY: 200, Size: 90, Color: yellow, Rotate: 30},
+	} {
+		op := newMemTexture(DefaultSize)
+		f.Do(op)
+
+		scene := (&Scene{Figures: []DrawT180{f}}).Render(DefaultSize)
+
+		raster := newMemTexture(DefaultSize)
+		fillPolygons(raster, [][]geom.Point{f.Geometry().Polygon()}, yellow)
+
+		g := f.Geometry()
+		box := g.Bounds()
+		renderers := []struct {
+			name string
+			img  *image.RGBA
+		}{{"Do", op.img}, {"polygon", raster.img}}
+		for y := 0; y < 500; y++ {
+			for x := 0; x < 500; x++ {
+				want := g.Contains(image.Pt(x, y))
+				for _, r := range renderers {
+					if got := r.img.RGBAAt(x, y) == yellow; got != want {
+						t.Fatalf("%+v: %s drew (%d, %d) = %v, geometry says %v", f, r.name, x, y, got, want)
+					}
+				}
+				if want && !image.Pt(x, y).In(box) {
+					t.Fatalf("%+v: (%d, %d) is outside the bounds %v", f, x, y, box)
+				}
+
+				// Full pixels are inside, pixels with the centre inside are
+				// at least partly covered and unrotated edges are sharp.
+				c := scene.RGBAAt(x, y)
+				full, touched := c == yellow, c.A > 0
+				if full && !want || want && !touched || f.Rotate == 0 && full != want {
+					t.Fatalf("%+v: Scene drew (%d, %d) as %v, geometry says %v", f, x, y, c, want)
+				}
+			}
+		}
+	}
+}
+
+// TestScene_RenderMatchesFill checks that scenes with edges on whole pixels
+// look the same through the anti-aliased renderer as through Texture.Fill.
+func TestScene_RenderMatchesFill(t *testing.T) {
+	bg := color.RGBA{0, 128, 0, 255}
+	yellow := color.RGBA{255, 255, 0, 255}
+	rect := image.Rect(100, 150, 300, 250)
+	s := Scene{
+		Background: bg,
+		BgRect:     &rect,
+		Border:     &Border{Thickness: 12, Color: color.RGBA{255, 0, 0, 255}},
+		Figures: []DrawT180{
+			{PosX: 200, PosY: 200, Size: 100, Color: yellow},
+			{PosX: 600, PosY: 550, Size: 150, Color: yellow, Outline: color.RGBA{0, 0, 255, 255}, OutlineWidth: 12},
+			{PosX: 400, PosY: 300, Size: 77, Color: yellow, Outline: color.RGBA{0, 0, 255, 255}, OutlineWidth: 4},
+			{PosX: 5, PosY: 795, Size: 120, Color: yellow, Rotate: 90},
+		},
+	}
+
+	filled := newMemTexture(DefaultSize)
+	s.draw(filled)
+	rendered := s.Render(DefaultSize)
+	if !bytes.Equal(filled.img.Pix, rendered.Pix) {
+		for y := range DefaultSize.Y {
+			for x := range DefaultSize.X {
+				if a, b := filled.img.RGBAAt(x, y), rendered.RGBAAt(x, y); a != b {
+					t.Fatalf("pixel (%d, %d): filled %v, rendered %v", x, y, a, b)
+				}
+			}
+		}
+	}
+}
+
+func TestRenderer_AntiAliases(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	r := newRenderer(img)
+	white := color.RGBA{255, 255, 255, 255}
+	// A diagonal half of the square: pixels on the diagonal are half covered.
+	r.fill([][]geom.Point{{{X: 0, Y: 0}, {X: 20, Y: 0}, {X: 20, Y: 20}}}, white)
+
+	if got := img.RGBAAt(15, 5); got != white {
+		t.Errorf("inside pixel = %v, want %v", got, white)
+	}
+	if got := img.RGBAAt(5, 15); got.A != 0 {
+		t.Errorf("outside pixel = %v, want transparent", got)
+	}
+	if got := img.RGBAAt(10, 10); got.A < 120 || got.A > 135 {
+		t.Errorf("edge pixel = %v, want about half covered", got)
+	}
+}
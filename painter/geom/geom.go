@@ -0,0 +1,170 @@
+// Package geom holds the geometry of the painter figures, shared by every
+// renderer and by hit-testing, so that they all agree on which pixels a
+// figure covers.
+package geom
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Point is a vertex in canvas coordinates.
+type Point struct {
+	X, Y float64
+}
+
+// T180 is the figure of the painter: the letter T turned by 180 degrees, a
+// horizontal bar through the centre with a stem going up from it. The bar
+// and the stem are Size/5 pixels thick and the figure is Size pixels wide
+// and about Size/2 pixels tall above the centre.
+type T180 struct {
+	Center image.Point
+	Size   int
+	// Rotate turns the figure clockwise around its centre, in degrees.
+	Rotate float64
+}
+
+// Rects returns the bar and the stem of the figure without rotation. They
+// do not overlap.
+func (f T180) Rects() [2]image.Rectangle {
+	c := f.Center
+	thickness := f.Size / 5
+	half := f.Size / 2
+	return [2]image.Rectangle{
+		image.Rect(c.X-half, c.Y-thickness/2, c.X+half, c.Y+thickness/2),
+		image.Rect(c.X-thickness/2, c.Y-half, c.X+thickness/2, c.Y-thickness/2),
+	}
+}
+
+// Polygon returns the outline of the rotated figure, clockwise on screen.
+func (f T180) Polygon() []Point {
+	bar, stem := f.Rects()[0], f.Rects()[1]
+	pt := func(x, y int) Point { return Point{float64(x), float64(y)} }
+	poly := []Point{
+		pt(bar.Min.X, bar.Min.Y),
+		pt(stem.Min.X, bar.Min.Y),
+		pt(stem.Min.X, stem.Min.Y),
+		pt(stem.Max.X, stem.Min.Y),
+		pt(stem.Max.X, bar.Min.Y),
+		pt(bar.Max.X, bar.Min.Y),
+		pt(bar.Max.X, bar.Max.Y),
+		pt(bar.Min.X, bar.Max.Y),
+	}
+	if f.Rotate == 0 {
+		return poly
+	}
+	return Rotate(poly, pt(f.Center.X, f.Center.Y), f.Rotate)
+}
+
+// Bounds returns the smallest rectangle holding every pixel of the figure.
+func (f T180) Bounds() image.Rectangle {
+	var r image.Rectangle
+	Spans([][]Point{f.Polygon()}, nil, func(s image.Rectangle) {
+		r = r.Union(s)
+	})
+	return r
+}
+
+// BoundsIn returns the bounds of the part of the figure inside clip. Only
+// the rows of clip are walked, so it is cheap for figures much larger than
+// the canvas.
+func (f T180) BoundsIn(clip image.Rectangle) image.Rectangle {
+	var r image.Rectangle
+	Spans([][]Point{f.Polygon()}, &clip, func(s image.Rectangle) {
+		r = r.Union(s)
+	})
+	return r
+}
+
+// Contains reports whether the figure covers the pixel p.
+func (f T180) Contains(p image.Point) bool {
+	return Inside([][]Point{f.Polygon()}, Point{float64(p.X) + 0.5, float64(p.Y) + 0.5})
+}
+
+// Rotate turns poly clockwise on screen by deg degrees around c.
+func Rotate(poly []Point, c Point, deg float64) []Point {
+	sin, cos := math.Sincos(deg * math.Pi / 180)
+	res := make([]Point, len(poly))
+	for i, p := range poly {
+		dx, dy := p.X-c.X, p.Y-c.Y
+		res[i] = Point{c.X + dx*cos - dy*sin, c.Y + dx*sin + dy*cos}
+	}
+	return res
+}
+
+// Inside reports whether p is inside the union of polys by the non-zero
+// winding rule.
+func Inside(polys [][]Point, p Point) bool {
+	winding := 0
+	for _, c := range crossings(polys, p.Y) {
+		if c.x > p.X {
+			break
+		}
+		winding += c.winding
+	}
+	return winding != 0
+}
+
+// Spans calls fn with one pixel high rectangles covering the pixels whose
+// centres are inside the union of polys by the non-zero winding rule. If
+// clip is not nil, only pixels inside it are reported.
+func Spans(polys [][]Point, clip *image.Rectangle, fn func(image.Rectangle)) {
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, poly := range polys {
+		for _, p := range poly {
+			minY, maxY = min(minY, p.Y), max(maxY, p.Y)
+		}
+	}
+	if minY > maxY {
+		return
+	}
+	y0, y1 := int(math.Floor(minY)), int(math.Ceil(maxY))
+	if clip != nil {
+		y0, y1 = max(y0, clip.Min.Y), min(y1, clip.Max.Y)
+	}
+
+	for y := y0; y < y1; y++ {
+		xs := crossings(polys, float64(y)+0.5)
+		winding := 0
+		for i, c := range xs {
+			winding += c.winding
+			if winding == 0 || i+1 == len(xs) {
+				continue
+			}
+			// Pixels whose centres lie between the two crossings.
+			x0 := int(math.Ceil(c.x - 0.5))
+			x1 := int(math.Ceil(xs[i+1].x - 0.5))
+			if clip != nil {
+				x0, x1 = max(x0, clip.Min.X), min(x1, clip.Max.X)
+			}
+			if x0 < x1 {
+				fn(image.Rect(x0, y, x1, y+1))
+			}
+		}
+	}
+}
+
+type crossing struct {
+	x       float64
+	winding int
+}
+
+// crossings returns where the edges of polys cross the line at y, sorted
+// by x, with the direction of each edge.
+func crossings(polys [][]Point, y float64) []crossing {
+	var xs []crossing
+	for _, poly := range polys {
+		for i, a := range poly {
+			c := poly[(i+1)%len(poly)]
+			switch {
+			case a.Y <= y && y < c.Y:
+				xs = append(xs, crossing{a.X + (y-a.Y)*(c.X-a.X)/(c.Y-a.Y), 1})
+			case c.Y <= y && y < a.Y:
+				xs = append(xs, crossing{a.X + (y-a.Y)*(c.X-a.X)/(c.Y-a.Y), -1})
+			}
+		}
+	}
+	sort.Slice(xs, func(i, j int) bool { return xs[i].x < xs[j].x })
+	return xs
+}
@@ -0,0 +1,157 @@
+package geom_test
+
+import (
+	"image"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter/geom"
+)
+
+func TestT180(t *testing.T) {
+	f := geom.T180{Center: image.Pt(400, 400), Size: 100}
+
+	rects := f.Rects()
+	if want := image.Rect(350, 390, 450, 410); rects[0] != want {
+		t.Errorf("bar = %v, want %v", rects[0], want)
+	}
+	if want := image.Rect(390, 350, 410, 390); rects[1] != want {
+		t.Errorf("stem = %v, want %v", rects[1], want)
+	}
+	if want := image.Rect(350, 350, 450, 410); f.Bounds() != want {
+		t.Errorf("Bounds() = %v, want %v", f.Bounds(), want)
+	}
+
+	// The polygon, its spans and the hit-test cover the same pixels as the
+	// rectangles.
+	covered := map[image.Point]bool{}
+	geom.Spans([][]geom.Point{f.Polygon()}, nil, func(r image.Rectangle) {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			covered[image.Pt(x, r.Min.Y)] = true
+		}
+	})
+	for y := 300; y < 500; y++ {
+		for x := 300; x < 500; x++ {
+			p := image.Pt(x, y)
+			want := p.In(rects[0]) || p.In(rects[1])
+			if covered[p] != want || f.Contains(p) != want {
+				t.Fatalf("pixel %v: spans %v, Contains %v, rectangles %v", p, covered[p], f.Contains(p), want)
+			}
+		}
+	}
+}
+
+func TestT180_BoundsIn(t *testing.T) {
+	f := geom.T180{Center: image.Pt(400, 400), Size: 100}
+	if got, want := f.BoundsIn(image.Rect(0, 0, 400, 400)), image.Rect(350, 350, 400, 400); got != want {
+		t.Errorf("BoundsIn() = %v, want %v", got, want)
+	}
+	if got := f.BoundsIn(image.Rect(0, 0, 100, 100)); !got.Empty() {
+		t.Errorf("BoundsIn() outside the figure = %v, want an empty rectangle", got)
+	}
+
+	// Rows off the clip are not walked, so this takes no time.
+	huge := geom.T180{Center: image.Pt(400, 400), Size: 2000000000}
+	if got, want := huge.BoundsIn(image.Rect(0, 0, 800, 800)), image.Rect(0, 0, 800, 800); got != want {
+		t.Errorf("BoundsIn() of a huge figure = %v, want %v", got, want)
+	}
+}
+
+func TestT180_Rotate(t *testing.T) {
+	tests := []struct {
+		rotate float64
+		bounds image.Rectangle
+		stem   image.Point
+		empty  image.Point
+	}{
+		{90, image.Rect(390, 350, 450, 450), image.Pt(440, 400), image.Pt(360, 400)},
+		{180, image.Rect(350, 390, 450, 450), image.Pt(400, 440), image.Pt(400, 360)},
+		{270, image.Rect(350, 350, 410, 450), image.Pt(360, 400), image.Pt(440, 400)},
+	}
+	for _, tt := range tests {
+		f := geom.T180{Center: image.Pt(400, 400), Size: 100, Rotate: tt.rotate}
+		if got := f.Bounds(); got != tt.bounds {
+			t.Errorf("rotate %v: Bounds() = %v, want %v", tt.rotate, got, tt.bounds)
+		}
+		if !f.Contains(tt.stem) {
+			t.Errorf("rotate %v: stem pixel %v not covered", tt.rotate, tt.stem)
+		}
+		if f.Contains(tt.empty) {
+			t.Errorf("rotate %v: pixel %v opposite the stem is covered", tt.rotate, tt.empty)
+		}
+	}
+}
+
+func TestStrokePath(t *testing.T) {
+	// An L going right and then down, 4 pixels wide.
+	l := []geom.Point{{10, 10}, {30, 10}, {30, 30}}
+	tests := []struct {
+		name   string
+		closed bool
+		join   geom.Join
+		cap    geom.Cap
+		in     []geom.Point
+		out    []geom.Point
+	}{
+		{
+			name: "miter",
+			join: geom.JoinMiter,
+			in:   []geom.Point{{31.9, 8.1}, {20, 11.9}, {28.1, 20}},
+			out:  []geom.Point{{9.5, 10}, {30, 30.5}, {20, 12.1}},
+		},
+		{
+			name: "bevel",
+			join: geom.JoinBevel,
+			in:   []geom.Point{{30.9, 9.1}},
+			out:  []geom.Point{{31.9, 8.1}},
+		},
+		{
+			name: "round",
+			join: geom.JoinRound,
+			in:   []geom.Point{{31.3, 8.7}},
+			out:  []geom.Point{{31.9, 8.1}},
+		},
+		{
+			name: "square caps",
+			cap:  geom.CapSquare,
+			in:   []geom.Point{{8.1, 10}, {30, 31.9}},
+			out:  []geom.Point{{7.9, 10}, {30, 32.1}},
+		},
+		{
+			name: "round caps",
+			cap:  geom.CapRound,
+			in:   []geom.Point{{8.5, 10.5}},
+			out:  []geom.Point{{8.1, 8.1}},
+		},
+		{
+			name:   "closed",
+			closed: true,
+			// The last corner gets a miter too.
+			in:  []geom.Point{{20, 20}, {30.5, 32.5}},
+			out: []geom.Point{{25, 15}, {11.9, 30}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shapes := geom.StrokePath(l, tt.closed, 4, tt.join, tt.cap)
+			for _, s := range shapes {
+				if geom.Area(s) < 0 {
+					t.Errorf("shape %v goes counter-clockwise", s)
+				}
+			}
+			for _, p := range tt.in {
+				if !geom.Inside(shapes, p) {
+					t.Errorf("%v is not on the stroke", p)
+				}
+			}
+			for _, p := range tt.out {
+				if geom.Inside(shapes, p) {
+					t.Errorf("%v is on the stroke", p)
+				}
+			}
+		})
+	}
+
+	if got := geom.StrokePath(l, false, 0, geom.JoinMiter, geom.CapButt); got != nil {
+		t.Errorf("zero width stroke = %v, want nothing", got)
+	}
+}
@@ -0,0 +1,195 @@
+package geom
+
+import "math"
+
+// Join is the shape of a stroke where two segments meet.
+type Join int
+
+const (
+	// JoinMiter extends the outer edges of the segments until they meet,
+	// falling back to JoinBevel at corners sharper than MiterLimit allows.
+	JoinMiter Join = iota
+	JoinRound
+	JoinBevel
+)
+
+// Cap is the shape of the ends of an open stroke.
+type Cap int
+
+const (
+	CapButt Cap = iota
+	CapSquare
+	CapRound
+)
+
+// MiterLimit is the longest miter allowed, in stroke widths.
+const MiterLimit = 4
+
+// StrokePath returns the shapes covering a line of the given width along
+// pts. A closed path also has a segment from the last point to the first
+// one and no caps. The shapes overlap and all go the same way round, so
+// that they can be filled together by the non-zero winding rule.
+func StrokePath(pts []Point, closed bool, width float64, join Join, cap Cap) [][]Point {
+	pts = dedup(pts, closed)
+	half := width / 2
+	if half <= 0 || len(pts) == 0 {
+		return nil
+	}
+	if len(pts) == 1 {
+		// A dot: only round and square caps give it a size.
+		switch {
+		case closed || cap == CapButt:
+			return nil
+		case cap == CapRound:
+			return [][]Point{circle(pts[0], half)}
+		default:
+			p := pts[0]
+			return [][]Point{orient([]Point{{p.X - half, p.Y - half}, {p.X + half, p.Y - half}, {p.X + half, p.Y + half}, {p.X - half, p.Y + half}})}
+		}
+	}
+
+	n := len(pts) - 1
+	if closed {
+		n = len(pts)
+	}
+	var res [][]Point
+	for i := range n {
+		a, b := pts[i], pts[(i+1)%len(pts)]
+		u := unit(a, b)
+		// Square caps stretch the first and the last segment.
+		if !closed && cap == CapSquare {
+			if i == 0 {
+				a = Point{a.X - u.X*half, a.Y - u.Y*half}
+			}
+			if i == n-1 {
+				b = Point{b.X + u.X*half, b.Y + u.Y*half}
+			}
+		}
+		nx, ny := -u.Y*half, u.X*half
+		res = append(res, orient([]Point{
+			{a.X + nx, a.Y + ny},
+			{b.X + nx, b.Y + ny},
+			{b.X - nx, b.Y - ny},
+			{a.X - nx, a.Y - ny},
+		}))
+	}
+
+	// Joins at the inner points, and at every point of a closed path.
+	for i := range pts {
+		if !closed && (i == 0 || i == len(pts)-1) {
+			continue
+		}
+		prev, p, next := pts[(i+len(pts)-1)%len(pts)], pts[i], pts[(i+1)%len(pts)]
+		if j := joinShape(prev, p, next, half, join); j != nil {
+			res = append(res, j)
+		}
+	}
+
+	if !closed && cap == CapRound {
+		res = append(res, circle(pts[0], half), circle(pts[len(pts)-1], half))
+	}
+	return res
+}
+
+// joinShape returns the shape filling the outer corner at p between the
+// segments from prev and to next, or nil for straight lines.
+func joinShape(prev, p, next Point, half float64, join Join) []Point {
+	u, v := unit(prev, p), unit(p, next)
+	cross := u.X*v.Y - u.Y*v.X
+	if math.Abs(cross) < 1e-9 && u.X*v.X+u.Y*v.Y > 0 {
+		return nil
+	}
+	if join == JoinRound {
+		return circle(p, half)
+	}
+
+	// The outer side is to the left of a right turn and the other way round.
+	side := half
+	if cross > 0 {
+		side = -half
+	}
+	a := Point{p.X - u.Y*side, p.Y + u.X*side}
+	b := Point{p.X - v.Y*side, p.Y + v.X*side}
+	if join == JoinMiter {
+		// The miter point is on the bisector of the outer normals, at
+		// half / cos(theta/2) from p.
+		mx, my := (a.X-p.X)+(b.X-p.X), (a.Y-p.Y)+(b.Y-p.Y)
+		ml := math.Hypot(mx, my)
+		if ml > 0 {
+			cos := ml / 2 / half
+			if length := half / cos; length <= MiterLimit*half {
+				m := Point{p.X + mx/ml*length, p.Y + my/ml*length}
+				return orient([]Point{p, a, m, b})
+			}
+		}
+	}
+	return orient([]Point{p, a, b})
+}
+
+// circle returns a polygon close enough to a circle of radius r around c
+// for its edges to stay within a tenth of a pixel.
+func circle(c Point, r float64) []Point {
+	return Ellipse(c, r, r)
+}
+
+// Ellipse returns a polygon close enough to the ellipse with radii rx and
+// ry around c for its edges to stay within a tenth of a pixel. It goes
+// clockwise on screen.
+func Ellipse(c Point, rx, ry float64) []Point {
+	n, r := 8, max(rx, ry)
+	for r*(1-math.Cos(math.Pi/float64(n))) > 0.1 {
+		n *= 2
+	}
+	res := make([]Point, n)
+	for i := range res {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		res[i] = Point{c.X + rx*math.Cos(a), c.Y + ry*math.Sin(a)}
+	}
+	return res
+}
+
+// orient returns poly going clockwise on screen, which is the positive
+// direction when y grows downwards.
+func orient(poly []Point) []Point {
+	if Area(poly) < 0 {
+		for i, j := 0, len(poly)-1; i < j; i, j = i+1, j-1 {
+			poly[i], poly[j] = poly[j], poly[i]
+		}
+	}
+	return poly
+}
+
+// Area returns the signed area of poly, positive if it goes clockwise on
+// screen.
+func Area(poly []Point) float64 {
+	var a float64
+	for i, p := range poly {
+		q := poly[(i+1)%len(poly)]
+		a += p.X*q.Y - q.X*p.Y
+	}
+	return a / 2
+}
+
+// unit returns the direction from a to b as a unit vector.
+func unit(a, b Point) Point {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	l := math.Hypot(dx, dy)
+	return Point{dx / l, dy / l}
+}
+
+// dedup drops points equal to the previous one, so that every segment has
+// a direction.
+func dedup(pts []Point, closed bool) []Point {
+	var res []Point
+	for _, p := range pts {
+		if len(res) == 0 || p != res[len(res)-1] {
+			res = append(res, p)
+		}
+	}
+	if closed {
+		for len(res) > 1 && res[0] == res[len(res)-1] {
+			res = res[:len(res)-1]
+		}
+	}
+	return res
+}
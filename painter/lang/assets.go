@@ -0,0 +1,118 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+type assetInfo struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// AssetsHandler serves the images sprites are drawn from:
+//
+//	GET    /assets         list images
+//	POST   /assets/{name}  store a PNG, JPEG or GIF image
+//	DELETE /assets/{name}  delete an image
+//
+// The size of an image is checked against MaxAssetPixels and the memory
+// limit of a before it is decoded.
+func AssetsHandler(a *painter.Assets) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /assets", func(rw http.ResponseWriter, r *http.Request) {
+		if !allow(rw, r, ScopeRead) {
+			return
+		}
+		list := []assetInfo{}
+		for _, name := range a.Names() {
+			if img, ok := a.Get(name); ok {
+				list = append(list, assetInfo{Name: name, Width: img.Rect.Dx(), Height: img.Rect.Dy()})
+			}
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(list)
+	})
+
+	mux.HandleFunc("POST /assets/{name}", func(rw http.ResponseWriter, r *http.Request) {
+		if !allow(rw, r, ScopeDraw) {
+			return
+		}
+		name := r.PathValue("name")
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			if tooLarge(err) {
+				http.Error(rw, tooLargeMessage(err), http.StatusRequestEntityTooLarge)
+			} else {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			http.Error(rw, "body must be a PNG, JPEG or GIF image", http.StatusUnsupportedMediaType)
+			return
+		}
+		size := image.Pt(cfg.Width, cfg.Height)
+		if err := painter.CheckAssetSize(size); err != nil {
+			writeAssetError(rw, err)
+			return
+		}
+		if !a.Fits(name, size) {
+			writeAssetError(rw, fmt.Errorf("%w: %s is %dx%d", painter.ErrAssetsFull, name, size.X, size.Y))
+			return
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("cannot decode %s image: %s", format, err), http.StatusBadRequest)
+			return
+		}
+		if err := a.Put(name, img); err != nil {
+			writeAssetError(rw, err)
+			return
+		}
+		log.Printf("Stored asset %s, a %dx%d %s image", name, cfg.Width, cfg.Height, format)
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(rw).Encode(assetInfo{Name: name, Width: cfg.Width, Height: cfg.Height})
+	})
+
+	mux.HandleFunc("DELETE /assets/{name}", func(rw http.ResponseWriter, r *http.Request) {
+		if !allow(rw, r, ScopeAdmin) {
+			return
+		}
+		if err := a.Delete(r.PathValue("name")); err != nil {
+			writeAssetError(rw, err)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+func writeAssetError(rw http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	switch {
+	case errors.Is(err, painter.ErrAssetNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, painter.ErrAssetsFull):
+		code = http.StatusInsufficientStorage
+	case errors.Is(err, painter.ErrAssetTooLarge):
+		code = http.StatusRequestEntityTooLarge
+	}
+	http.Error(rw, err.Error(), code)
+}
@@ -0,0 +1,82 @@
+package lang_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+func TestAssetsHandler(t *testing.T) {
+	assets := &painter.Assets{Max: 4 * 20 * 20}
+	handler := lang.AssetsHandler(assets)
+	do := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		return w
+	}
+	encode := func(w, h int, enc func(*bytes.Buffer, image.Image) error) []byte {
+		img := image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Transparent, color.White})
+		var buf bytes.Buffer
+		if err := enc(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	pngEnc := func(b *bytes.Buffer, img image.Image) error { return png.Encode(b, img) }
+	gifEnc := func(b *bytes.Buffer, img image.Image) error { return gif.Encode(b, img, nil) }
+
+	for _, tt := range []struct {
+		method, path string
+		body         []byte
+		want         int
+	}{
+		{"POST", "/assets/logo", encode(10, 10, pngEnc), http.StatusCreated},
+		{"POST", "/assets/icon.gif", encode(10, 10, gifEnc), http.StatusCreated},
+		{"POST", "/assets/big", encode(20, 20, pngEnc), http.StatusInsufficientStorage},
+		{"POST", "/assets/text", []byte("hello"), http.StatusUnsupportedMediaType},
+		{"POST", "/assets/bad%20name", encode(1, 1, pngEnc), http.StatusBadRequest},
+		{"DELETE", "/assets/icon.gif", nil, http.StatusNoContent},
+		{"DELETE", "/assets/icon.gif", nil, http.StatusNotFound},
+	} {
+		if w := do(tt.method, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s: status %d, want %d: %s", tt.method, tt.path, w.Code, tt.want, w.Body)
+		}
+	}
+
+	// The pixel limit holds even without a memory limit.
+	unlimited := lang.AssetsHandler(&painter.Assets{})
+	w := httptest.NewRecorder()
+	unlimited.ServeHTTP(w, httptest.NewRequest("POST", "/assets/huge", bytes.NewReader(pngHeaderSize(encode(1, 1, pngEnc), 100000, 100000))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST of a 100000x100000 PNG: status %d, want %d: %s", w.Code, http.StatusRequestEntityTooLarge, w.Body)
+	}
+
+	if img, ok := assets.Get("logo"); !ok || img.Rect.Size() != image.Pt(10, 10) {
+		t.Errorf("logo = %v, %v, want a 10x10 image", img, ok)
+	}
+	if w := do("GET", "/assets", nil); w.Body.String() != `[{"name":"logo","width":10,"height":10}]`+"\n" {
+		t.Errorf("GET /assets = %s", w.Body)
+	}
+}
+
+// pngHeaderSize rewrites the size in the header of a PNG file, leaving the
+// image data as it is.
+func pngHeaderSize(data []byte, w, h uint32) []byte {
+	data = bytes.Clone(data)
+	// The IHDR chunk follows the 8 byte signature: length, type, then the
+	// width and height, and a CRC of the type and data.
+	binary.BigEndian.PutUint32(data[16:], w)
+	binary.BigEndian.PutUint32(data[20:], h)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
@@ -0,0 +1,202 @@
+package lang
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// Scope is a permission granted to an API token.
+type Scope string
+
+const (
+	// ScopeRead allows reading frames, scenes and events.
+	ScopeRead Scope = "read"
+	// ScopeDraw allows scripts that draw, move, reset and update.
+	ScopeDraw Scope = "draw"
+	// ScopeAdmin allows scene replacement and canvas management.
+	ScopeAdmin Scope = "admin"
+)
+
+// Token is an API token. Its secret is only kept as a hash.
+type Token struct {
+	ID     string
+	Scopes []Scope
+}
+
+// Has reports whether the token was granted s.
+func (t *Token) Has(s Scope) bool {
+	return slices.Contains(t.Scopes, s)
+}
+
+// Tokens authenticates HTTP requests with bearer tokens.
+type Tokens struct {
+	bySecret map[[sha256.Size]byte]*Token
+}
+
+// LoadTokens reads tokens from a file in the format of ParseTokens.
+func LoadTokens(path string) (*Tokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ts, err := ParseTokens(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ts, nil
+}
+
+// ParseTokens reads one token per line as
+//
+//	<id> <secret> <scope>[,<scope>...]
+//
+// Empty lines and lines starting with # are skipped.
+func ParseTokens(in io.Reader) (*Tokens, error) {
+	ts := &Tokens{bySecret: map[[sha256.Size]byte]*Token{}}
+	ids := map[string]bool{}
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: want <id> <secret> <scopes>, got %d fields", line, len(fields))
+		}
+		tok := &Token{ID: fields[0]}
+		for _, s := range strings.Split(fields[2], ",") {
+			switch sc := Scope(s); sc {
+			case ScopeRead, ScopeDraw, ScopeAdmin:
+				tok.Scopes = append(tok.Scopes, sc)
+			default:
+				return nil, fmt.Errorf("line %d: token %s: unknown scope %q", line, tok.ID, s)
+			}
+		}
+		if ids[tok.ID] {
+			return nil, fmt.Errorf("line %d: duplicate token id %s", line, tok.ID)
+		}
+		sum := sha256.Sum256([]byte(fields[1]))
+		if _, ok := ts.bySecret[sum]; ok {
+			return nil, fmt.Errorf("line %d: token %s reuses the secret of another token", line, tok.ID)
+		}
+		ids[tok.ID] = true
+		ts.bySecret[sum] = tok
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// lookup returns the token with the given secret, or nil.
+func (ts *Tokens) lookup(secret string) *Token {
+	return ts.bySecret[sha256.Sum256([]byte(strings.TrimSpace(secret)))]
+}
+
+// openToken is the token of line connections when there are no Tokens.
+var openToken = &Token{ID: "open", Scopes: []Scope{ScopeRead, ScopeDraw, ScopeAdmin}}
+
+// check returns an error if the token lacks any of scopes.
+func (t *Token) check(scopes []Scope) error {
+	for _, s := range scopes {
+		if !t.Has(s) {
+			return fmt.Errorf("token lacks the %s scope", s)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of tokens.
+func (ts *Tokens) Len() int {
+	return len(ts.bySecret)
+}
+
+type tokenKey struct{}
+
+// Authenticate rejects requests without a known bearer token with 401 and
+// passes the token on to h. The handlers of this package then check its
+// scopes. A nil Tokens lets every request through.
+func (ts *Tokens) Authenticate(h http.Handler) http.Handler {
+	if ts == nil {
+		return h
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		var tok *Token
+		if ok {
+			tok = ts.lookup(secret)
+		}
+		if tok == nil {
+			reason := "missing bearer token"
+			if ok {
+				reason = "unknown token"
+			}
+			log.Printf("Rejected %s %s from %s: %s", r.Method, r.URL.Path, r.RemoteAddr, reason)
+			rw.Header().Set("WWW-Authenticate", `Bearer realm="painter"`)
+			http.Error(rw, reason, http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), tokenKey{}, tok)))
+	})
+}
+
+// allow reports whether the request's token has all of scopes and responds
+// with 403 if not. Requests that did not pass Authenticate are allowed.
+func allow(rw http.ResponseWriter, r *http.Request, scopes ...Scope) bool {
+	tok, ok := r.Context().Value(tokenKey{}).(*Token)
+	if !ok {
+		return true
+	}
+	for _, s := range scopes {
+		if !tok.Has(s) {
+			log.Printf("Rejected %s %s from %s: token %s lacks the %s scope", r.Method, r.URL.Path, r.RemoteAddr, tok.ID, s)
+			http.Error(rw, fmt.Sprintf("token lacks the %s scope", s), http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+// scriptScopes returns the scopes needed to post ops. Reset only needs
+// ScopeDraw, as clients such as the animator clear the canvas every frame.
+func scriptScopes(ops []painter.Operation) []Scope {
+	for _, op := range ops {
+		if _, ok := op.(painter.SetScene); ok {
+			return []Scope{ScopeDraw, ScopeAdmin}
+		}
+	}
+	return []Scope{ScopeDraw}
+}
+
+// BearerTransport adds a bearer token to every request sent through Base,
+// or through http.DefaultTransport if Base is nil. An empty Token sends no
+// Authorization header.
+type BearerTransport struct {
+	Token string
+	Base  http.RoundTripper
+}
+
+func (t *BearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Token == "" {
+		return base.RoundTrip(r)
+	}
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.Token)
+	return base.RoundTrip(r)
+}
@@ -0,0 +1,119 @@
+package lang_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+const testTokens = `
+# id      secret        scopes
+viewer    view-secret   read
+artist    draw-secret   read,draw
+operator  admin-secret  draw,admin
+`
+
+func TestParseTokens(t *testing.T) {
+	ts, err := lang.ParseTokens(strings.NewReader(testTokens))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", ts.Len())
+	}
+
+	for _, bad := range []string{
+		"viewer view-secret",
+		"viewer view-secret paint",
+		"a s1 read\na s2 read",
+		"a same read\nb same read",
+	} {
+		if _, err := lang.ParseTokens(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseTokens(%q) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestTokens_Authenticate(t *testing.T) {
+	ts, err := lang.ParseTokens(strings.NewReader(testTokens))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop := &painter.Loop{}
+	loop.Start(nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", lang.HttpHandler(loop, &lang.Parser{}))
+	mux.Handle("/frame.png", lang.FrameHandler(loop))
+	mux.Handle("/scene", lang.SceneHandler(loop))
+	handler := ts.Authenticate(mux)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	for _, tc := range []struct {
+		name, secret, method, path, body string
+		want                             int
+	}{
+		{"no token", "", http.MethodGet, "/frame.png", "", http.StatusUnauthorized},
+		{"unknown token", "guess", http.MethodGet, "/frame.png", "", http.StatusUnauthorized},
+		{"read frame", "view-secret", http.MethodGet, "/frame.png", "", http.StatusOK},
+		{"read scene", "view-secret", http.MethodGet, "/scene", "", http.StatusOK},
+		{"draw without scope", "view-secret", http.MethodPost, "/", "figure 1 1", http.StatusForbidden},
+		{"draw", "draw-secret", http.MethodPost, "/", "figure 1 1\nupdate", http.StatusOK},
+		{"reset without draw", "view-secret", http.MethodPost, "/", "reset", http.StatusForbidden},
+		{"reset", "draw-secret", http.MethodPost, "/", "reset\nwhite\nupdate", http.StatusOK},
+		{"replace scene without admin", "draw-secret", http.MethodPut, "/scene", `{"background":"#ffffff"}`, http.StatusForbidden},
+		{"replace scene", "admin-secret", http.MethodPut, "/scene", `{"background":"#ffffff"}`, http.StatusOK},
+		{"read without scope", "admin-secret", http.MethodGet, "/scene", "", http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.secret != "" {
+				r.Header.Set("Authorization", "Bearer "+tc.secret)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tc.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+
+	loop.StopAndWait()
+	out := logs.String()
+	if !strings.Contains(out, "token artist lacks the admin scope") {
+		t.Errorf("rejections are not logged with the token ID:\n%s", out)
+	}
+	for _, secret := range []string{"guess", "view-secret", "draw-secret", "admin-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log contains the secret %q:\n%s", secret, out)
+		}
+	}
+}
+
+func TestBearerTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	c := &http.Client{Transport: &lang.BearerTransport{Token: "s3cret"}}
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got != "Bearer s3cret" {
+		t.Errorf("Authorization = %q, want %q", got, "Bearer s3cret")
+	}
+}
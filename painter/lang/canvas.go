@@ -0,0 +1,121 @@
+package lang
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+type canvasInfo struct {
+	Name  string `json:"name"`
+	Frame uint64 `json:"frame"`
+	Shown bool   `json:"shown"`
+}
+
+// CanvasHandler serves the named canvases of reg:
+//
+//	GET    /canvases              list canvases
+//	PUT    /canvases/{name}       create a canvas
+//	DELETE /canvases/{name}       delete a canvas
+//	POST   /canvases/{name}/show  show a canvas in the window
+//	       /c/{name}/             scripts, as served by HttpHandler
+//	       /c/{name}/frame.png    the last frame, as served by FrameHandler
+//	       /c/{name}/scene        the scene, as served by SceneHandler
+//	       /c/{name}/events       events, as served by EventsHandler
+//
+// Posting a script to /c/{name}/ creates the canvas if it does not exist.
+func CanvasHandler(reg *painter.Registry, p *Parser) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /canvases", func(rw http.ResponseWriter, r *http.Request) {
+		if !allow(rw, r, ScopeRead) {
+			return
+		}
+		shown := reg.Shown()
+		list := []canvasInfo{}
+		for _, name := range reg.Names() {
+			if l, ok := reg.Get(name); ok {
+				list = append(list, canvasInfo{Name: name, Frame: l.FrameSeq(), Shown: name == shown})
+			}
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(list)
+	})
+
+	mux.HandleFunc("PUT /canvases/{name}", func(rw http.ResponseWriter, r *http.Request) {
+		if !allow(rw, r, ScopeAdmin) {
+			return
+		}
+		if _, err := reg.Create(r.PathValue("name")); err != nil {
+			writeCanvasError(rw, err)
+			return
+		}
+		rw.WriteHeader(http.StatusCreated)
+	})
+
+	mux.HandleFunc("DELETE /canvases/{name}", func(rw http.ResponseWriter, r *http.Request) {
+		if !allow(rw, r, ScopeAdmin) {
+			return
+		}
+		if err := reg.Delete(r.PathValue("name")); err != nil {
+			writeCanvasError(rw, err)
+			return
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /canvases/{name}/show", func(rw http.ResponseWriter, r *http.Request) {
+		if !allow(rw, r, ScopeDraw) {
+			return
+		}
+		if err := reg.Show(r.PathValue("name")); err != nil {
+			writeCanvasError(rw, err)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	existing := func(h func(*painter.Loop) http.Handler) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			l, ok := reg.Get(r.PathValue("name"))
+			if !ok {
+				writeCanvasError(rw, painter.ErrCanvasNotFound)
+				return
+			}
+			h(l).ServeHTTP(rw, r)
+		}
+	}
+	mux.Handle("/c/{name}/frame.png", existing(FrameHandler))
+	mux.Handle("/c/{name}/scene", existing(SceneHandler))
+	mux.Handle("/c/{name}/events", existing(EventsHandler))
+
+	mux.HandleFunc("/c/{name}/{$}", func(rw http.ResponseWriter, r *http.Request) {
+		// Check before the canvas is created; HttpHandler checks the script.
+		if !allow(rw, r, ScopeDraw) {
+			return
+		}
+		l, err := reg.GetOrCreate(r.PathValue("name"))
+		if err != nil {
+			writeCanvasError(rw, err)
+			return
+		}
+		HttpHandler(l, p).ServeHTTP(rw, r)
+	})
+
+	return mux
+}
+
+func writeCanvasError(rw http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	switch {
+	case errors.Is(err, painter.ErrCanvasNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, painter.ErrCanvasExists):
+		code = http.StatusConflict
+	case errors.Is(err, painter.ErrTooManyCanvases):
+		code = http.StatusForbidden
+	}
+	http.Error(rw, err.Error(), code)
+}
@@ -0,0 +1,89 @@
+package lang_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+func TestCanvasHandler(t *testing.T) {
+	reg := &painter.Registry{Max: 2}
+	reg.Start(nil)
+	defer reg.StopAndWait()
+	handler := lang.CanvasHandler(reg, &lang.Parser{})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := do(http.MethodGet, "/c/team-a/scene", ""); w.Code != http.StatusNotFound {
+		t.Errorf("scene of a missing canvas: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := do(http.MethodPost, "/c/team-a/", "white\nupdate\n"); w.Code != http.StatusOK {
+		t.Errorf("script to a new canvas: status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if w := do(http.MethodPut, "/canvases/team-b", ""); w.Code != http.StatusForbidden {
+		t.Errorf("canvas over the limit: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := do(http.MethodPut, "/canvases/team-a", ""); w.Code != http.StatusConflict {
+		t.Errorf("existing canvas: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := do(http.MethodPost, "/canvases/team-a/show", ""); w.Code != http.StatusOK {
+		t.Errorf("show: status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	teamA, _ := reg.Get("team-a")
+	waitFor(t, func() bool { return teamA.FrameSeq() == 3 })
+	def, _ := reg.Get(painter.DefaultCanvas)
+	waitFor(t, func() bool { return def.FrameSeq() == 1 })
+
+	var list []map[string]any
+	if err := json.Unmarshal(do(http.MethodGet, "/canvases", "").Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{
+		{"name": "default", "frame": 1.0, "shown": false},
+		{"name": "team-a", "frame": 3.0, "shown": true},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("canvases = %v, want %v", list, want)
+	}
+
+	w := do(http.MethodGet, "/c/team-a/scene", "")
+	if !strings.Contains(w.Body.String(), `"background":"#ffffffff"`) {
+		t.Errorf("team-a scene = %s, want a white background", w.Body)
+	}
+	if w := do(http.MethodGet, "/c/team-a/frame.png", ""); w.Header().Get("X-Frame-Seq") != "3" {
+		t.Errorf("team-a frame seq = %q, want 3", w.Header().Get("X-Frame-Seq"))
+	}
+
+	if w := do(http.MethodDelete, "/canvases/team-a", ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if w := do(http.MethodDelete, "/canvases/default", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("delete default: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if got := reg.Shown(); got != painter.DefaultCanvas {
+		t.Errorf("shown canvas after delete = %q, want %q", got, painter.DefaultCanvas)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the loop")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
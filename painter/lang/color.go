@@ -0,0 +1,47 @@
+package lang
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+var namedColors = map[string]color.RGBA{
+	"black":  {0, 0, 0, 255},
+	"white":  {255, 255, 255, 255},
+	"red":    {255, 0, 0, 255},
+	"green":  {0, 255, 0, 255},
+	"blue":   {0, 0, 255, 255},
+	"yellow": {255, 255, 0, 255},
+}
+
+// ParseColor accepts a colour name or a hex value in the #rgb, #rgba,
+// #rrggbb or #rrggbbaa form. The alpha of hex values is straight, as in
+// CSS; the result is premultiplied, as color.RGBA has to be.
+func ParseColor(s string) (color.RGBA, error) {
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	hex, ok := strings.CutPrefix(s, "#")
+	if !ok {
+		return color.RGBA{}, fmt.Errorf("unknown color %q", s)
+	}
+	if len(hex) == 3 || len(hex) == 4 {
+		var long strings.Builder
+		for _, r := range hex {
+			long.WriteRune(r)
+			long.WriteRune(r)
+		}
+		hex = long.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	n := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(n).(color.RGBA), nil
+}
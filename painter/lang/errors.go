@@ -0,0 +1,91 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseError describes a single problem in a script. For text scripts Line
+// and Column are 1-based and point at the offending token. For JSON commands
+// Element is the 1-based index of the offending array element and Token names
+// the offending field.
+type ParseError struct {
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Element int    `json:"element,omitempty"`
+	Command string `json:"command,omitempty"`
+	Token   string `json:"token,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	var pos string
+	switch {
+	case e.Line != 0:
+		pos = fmt.Sprintf("line %d, column %d: ", e.Line, e.Column)
+	case e.Element != 0:
+		pos = fmt.Sprintf("element %d: ", e.Element)
+	}
+	if e.Command != "" {
+		return pos + e.Command + ": " + e.Message
+	}
+	return pos + e.Message
+}
+
+// ErrorList is returned by Parser.Parse when a script contains errors. It
+// holds every error found, in source order.
+type ErrorList []*ParseError
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// maxErrors caps the number of errors reported for one script.
+const maxErrors = 100
+
+func (l *ErrorList) add(e *ParseError) {
+	if len(*l) >= maxErrors {
+		return
+	}
+	for _, prev := range *l {
+		if *prev == *e {
+			return
+		}
+	}
+	*l = append(*l, e)
+}
+
+func (l *ErrorList) addf(line int, cmd string, at field, format string, args ...any) {
+	l.add(&ParseError{
+		Line:    line,
+		Column:  at.col,
+		Command: cmd,
+		Token:   at.text,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// addErr records err, taking its position from err itself when it is an
+// expression error and from at otherwise.
+func (l *ErrorList) addErr(line int, cmd string, at field, err error) {
+	var ee *exprError
+	if errors.As(err, &ee) {
+		l.add(&ParseError{Line: line, Column: ee.col, Command: cmd, Token: ee.token, Message: ee.msg})
+		return
+	}
+	l.addf(line, cmd, at, "%s", err)
+}
+
+// exprError is an expression error positioned at a column of the source line.
+type exprError struct {
+	col   int
+	token string
+	msg   string
+}
+
+func (e *exprError) Error() string { return e.msg }
@@ -0,0 +1,238 @@
+package lang
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type env map[string]float64
+
+type expr interface {
+	eval(e env) (float64, error)
+}
+
+type numLit float64
+
+func (n numLit) eval(env) (float64, error) { return float64(n), nil }
+
+type varRef struct {
+	name string
+	col  int
+}
+
+func (v varRef) eval(e env) (float64, error) {
+	val, ok := e[v.name]
+	if !ok {
+		return 0, &exprError{col: v.col, token: v.name, msg: "undefined variable: " + v.name}
+	}
+	return val, nil
+}
+
+type unaryExpr struct {
+	op byte
+	x  expr
+}
+
+func (u unaryExpr) eval(e env) (float64, error) {
+	x, err := u.x.eval(e)
+	if err != nil {
+		return 0, err
+	}
+	if u.op == '-' {
+		return -x, nil
+	}
+	return x, nil
+}
+
+type binaryExpr struct {
+	op   byte
+	col  int
+	x, y expr
+}
+
+func (b binaryExpr) eval(e env) (float64, error) {
+	x, err := b.x.eval(e)
+	if err != nil {
+		return 0, err
+	}
+	y, err := b.y.eval(e)
+	if err != nil {
+		return 0, err
+	}
+	switch b.op {
+	case '+':
+		return x + y, nil
+	case '-':
+		return x - y, nil
+	case '*':
+		return x * y, nil
+	case '/':
+		if y == 0 {
+			return 0, &exprError{col: b.col, token: "/", msg: "division by zero"}
+		}
+		return x / y, nil
+	case '%':
+		if int(y) == 0 {
+			return 0, &exprError{col: b.col, token: "%", msg: "division by zero"}
+		}
+		return float64(int(x) % int(y)), nil
+	}
+	return 0, &exprError{col: b.col, token: string(b.op), msg: "unknown operator"}
+}
+
+// parseExpr parses an arithmetic expression built from numbers, variable
+// names, the + - * / % operators and parentheses. base is the source column
+// of s[0] and is used to position errors.
+func parseExpr(s string, base int) (expr, error) {
+	ep := exprParser{src: s, base: base}
+	x, err := ep.sum()
+	if err != nil {
+		return nil, err
+	}
+	ep.skipSpaces()
+	if ep.pos < len(ep.src) {
+		return nil, ep.errorf(ep.src[ep.pos:ep.pos+1], "unexpected %q in expression", ep.src[ep.pos:ep.pos+1])
+	}
+	return x, nil
+}
+
+type exprParser struct {
+	src  string
+	pos  int
+	base int
+}
+
+func (ep *exprParser) errorf(token, format string, args ...any) error {
+	return &exprError{col: ep.base + ep.pos, token: token, msg: fmt.Sprintf(format, args...)}
+}
+
+func (ep *exprParser) skipSpaces() {
+	for ep.pos < len(ep.src) && (ep.src[ep.pos] == ' ' || ep.src[ep.pos] == '\t') {
+		ep.pos++
+	}
+}
+
+func (ep *exprParser) peek() byte {
+	ep.skipSpaces()
+	if ep.pos >= len(ep.src) {
+		return 0
+	}
+	return ep.src[ep.pos]
+}
+
+func (ep *exprParser) sum() (expr, error) {
+	x, err := ep.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ep.peek()
+		if op != '+' && op != '-' {
+			return x, nil
+		}
+		col := ep.base + ep.pos
+		ep.pos++
+		y, err := ep.product()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: op, col: col, x: x, y: y}
+	}
+}
+
+func (ep *exprParser) product() (expr, error) {
+	x, err := ep.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ep.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return x, nil
+		}
+		col := ep.base + ep.pos
+		ep.pos++
+		y, err := ep.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryExpr{op: op, col: col, x: x, y: y}
+	}
+}
+
+func (ep *exprParser) unary() (expr, error) {
+	if op := ep.peek(); op == '-' || op == '+' {
+		ep.pos++
+		x, err := ep.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: op, x: x}, nil
+	}
+	return ep.primary()
+}
+
+func (ep *exprParser) primary() (expr, error) {
+	c := ep.peek()
+	switch {
+	case c == 0:
+		return nil, ep.errorf("", "unexpected end of expression")
+
+	case c == '(':
+		ep.pos++
+		x, err := ep.sum()
+		if err != nil {
+			return nil, err
+		}
+		if ep.peek() != ')' {
+			return nil, ep.errorf("", "missing ) in expression")
+		}
+		ep.pos++
+		return x, nil
+
+	case isDigit(c) || c == '.':
+		start := ep.pos
+		for ep.pos < len(ep.src) && (isDigit(ep.src[ep.pos]) || ep.src[ep.pos] == '.') {
+			// Stop before a range operator so that "0..10" lexes as two numbers.
+			if ep.src[ep.pos] == '.' && ep.pos+1 < len(ep.src) && ep.src[ep.pos+1] == '.' {
+				break
+			}
+			ep.pos++
+		}
+		text := ep.src[start:ep.pos]
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			ep.pos = start
+			return nil, ep.errorf(text, "invalid number %q", text)
+		}
+		return numLit(v), nil
+
+	case isIdentStart(c):
+		start := ep.pos
+		for ep.pos < len(ep.src) && isIdentPart(ep.src[ep.pos]) {
+			ep.pos++
+		}
+		return varRef{name: ep.src[start:ep.pos], col: ep.base + start}, nil
+	}
+	return nil, ep.errorf(string(c), "unexpected %q in expression", string(c))
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool { return isIdentStart(c) || isDigit(c) }
+
+func isIdent(s string) bool {
+	if s == "" || !isIdentStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isIdentPart(s[i]) {
+			return false
+		}
+	}
+	return true
+}
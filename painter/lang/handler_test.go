@@ -1,8 +1,12 @@
 package lang_test
 
 import (
+	"encoding/json"
+	"image"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -54,3 +58,145 @@ func TestHttpHandler(t *testing.T) {
 		}
 	})
 }
+
+func TestHttpHandler_ErrorBody(t *testing.T) {
+	handler := lang.HttpHandler(&painter.Loop{}, &lang.Parser{})
+	body := "white\nfigure 1 x\nfoo\n"
+
+	t.Run("JSON", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var got struct {
+			Errors []lang.ParseError `json:"errors"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		want := []lang.ParseError{
+			{Line: 2, Column: 10, Command: "figure", Token: "x", Message: "undefined variable: x"},
+			{Line: 3, Column: 1, Token: "foo", Message: "unknown command: foo"},
+		}
+		if !reflect.DeepEqual(got.Errors, want) {
+			t.Errorf("errors = %+v, want %+v", got.Errors, want)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		got := w.Body.String()
+		want := "line 2, column 10: figure: undefined variable: x\nline 3, column 1: unknown command: foo\n"
+		if got != want {
+			t.Errorf("body = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestHttpHandler_JSON(t *testing.T) {
+	handler := lang.HttpHandler(&painter.Loop{}, &lang.Parser{})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[{"op":"figure","x":400,"y":400,"color":"#ff0"},{"op":"update"}]`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[{"op":"figure","x":400}]`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if want := "element 1: figure: missing field \"y\"\n"; w.Code != http.StatusBadRequest || w.Body.String() != want {
+		t.Errorf("got %d %q, want %d %q", w.Code, w.Body, http.StatusBadRequest, want)
+	}
+}
+
+func TestSchemaHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	lang.SchemaHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/schema.json", nil))
+
+	var schema map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %s", err)
+	}
+	if schema["type"] != "array" {
+		t.Errorf("schema type = %v, want array", schema["type"])
+	}
+}
+
+func TestFrameHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	lang.FrameHandler(&painter.Loop{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/frame.png", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", ct)
+	}
+	if seq := w.Header().Get("X-Frame-Seq"); seq != "0" {
+		t.Errorf("X-Frame-Seq = %q, want 0", seq)
+	}
+	img, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(800, 800) {
+		t.Errorf("frame size = %v, want 800x800", got)
+	}
+}
+
+func TestSceneHandler(t *testing.T) {
+	handler := lang.SceneHandler(&painter.Loop{})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/scene", nil))
+	if want := `{"background":"#00000000","bgrect":null,"border":null,"figures":[],"shapes":[]}` + "\n"; w.Body.String() != want {
+		t.Errorf("GET body = %s, want %s", w.Body, want)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/scene", strings.NewReader(`{"background":"#ffffff","figures":[]}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("PUT status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/scene", strings.NewReader(`{"background":"white"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("PUT with a bad color: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// Scenes are bounded like scripts, relative to the canvas.
+	for _, body := range []string{
+		`{"background":"#ffffff","figures":[{"x":400,"y":400,"size":200000000,"color":"#ffff00"}]}`,
+		`{"background":"#ffffff","figures":[{"x":400,"y":400,"size":100,"color":"#ffff00","outline":{"width":5000,"color":"#000000"}}]}`,
+		`{"background":"#ffffff","shapes":[{"id":"c","kind":"circle","points":[{"x":400,"y":400}],"rx":2000000000,"ry":2000000000}]}`,
+		`{"background":"#ffffff","shapes":[{"id":"t","kind":"text","points":[{"x":0,"y":100}],"text":"a","size":1000000}]}`,
+		`{"background":"#ffffff","shapes":[{"id":"s","kind":"sprite","points":[{"x":0,"y":0}],"asset":"logo","w":200000,"h":200000}]}`,
+	} {
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/scene", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: status = %d, want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/scene", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
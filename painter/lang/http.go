@@ -1,25 +1,39 @@
 package lang
 
 import (
-	"io"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
 	"log"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/roman-mazur/architecture-lab-3/painter"
 )
 
 func HttpHandler(loop *painter.Loop, p *Parser) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
-		var in io.Reader = r.Body
+		var (
+			cmds []painter.Operation
+			err  error
+		)
 		if r.Method == http.MethodGet {
-			in = strings.NewReader(r.URL.Query().Get("cmd"))
+			cmds, err = p.Parse(strings.NewReader(r.URL.Query().Get("cmd")))
+		} else if isJSON(r) {
+			cmds, err = p.ParseJSON(r.Body)
+		} else {
+			cmds, err = p.Parse(r.Body)
 		}
-
-		cmds, err := p.Parse(in)
 		if err != nil {
 			log.Printf("Bad script: %s", err)
-			rw.WriteHeader(http.StatusBadRequest)
+			writeParseError(rw, r, err)
+			return
+		}
+		if !allow(rw, r, scriptScopes(cmds)...) || !take(rw, r, len(cmds)) {
 			return
 		}
 
@@ -30,3 +44,133 @@ func HttpHandler(loop *painter.Loop, p *Parser) http.Handler {
 		rw.WriteHeader(http.StatusOK)
 	})
 }
+
+func isJSON(r *http.Request) bool {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt == "application/json"
+}
+
+// writeParseError responds with 400 and describes err as JSON when the client
+// accepts it and as plain text, one error per line, otherwise.
+// Errors caused by size limits get 413 instead.
+func writeParseError(rw http.ResponseWriter, r *http.Request, err error) {
+	if tooLarge(err) {
+		http.Error(rw, tooLargeMessage(err), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		errs = ErrorList{{Message: err.Error()}}
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(rw).Encode(struct {
+			Errors ErrorList `json:"errors"`
+		}{errs})
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.WriteHeader(http.StatusBadRequest)
+	for _, e := range errs {
+		fmt.Fprintln(rw, e.Error())
+	}
+}
+
+// FrameHandler serves the last presented frame as a PNG image. The frame
+// sequence number is sent in the X-Frame-Seq header.
+func FrameHandler(loop *painter.Loop) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !allow(rw, r, ScopeRead) {
+			return
+		}
+		img, seq := loop.Frame()
+		rw.Header().Set("Content-Type", "image/png")
+		rw.Header().Set("X-Frame-Seq", strconv.FormatUint(seq, 10))
+		if err := png.Encode(rw, img); err != nil {
+			log.Printf("Cannot encode frame: %s", err)
+		}
+	})
+}
+
+// SceneHandler returns the current scene as JSON on GET and replaces it on
+// PUT. A replaced scene is presented right away.
+func SceneHandler(loop *painter.Loop) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if !allow(rw, r, ScopeRead) {
+				return
+			}
+			rw.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(rw).Encode(loop.Scene())
+
+		case http.MethodPut:
+			if !allow(rw, r, ScopeAdmin) {
+				return
+			}
+			var s painter.Scene
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				writeParseError(rw, r, fmt.Errorf("bad scene: %w", err))
+				return
+			}
+			if err := s.Check(loop.CanvasSize()); err != nil {
+				writeParseError(rw, r, fmt.Errorf("bad scene: %w", err))
+				return
+			}
+			if !take(rw, r, 1) {
+				return
+			}
+			loop.Post(painter.SetScene{Scene: s})
+			loop.Post(painter.UpdateOp)
+			rw.WriteHeader(http.StatusOK)
+
+		default:
+			rw.Header().Set("Allow", "GET, PUT")
+			rw.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// EventsHandler streams an event for every operation the loop handles as
+// server-sent events.
+func EventsHandler(loop *painter.Loop) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !allow(rw, r, ScopeRead) {
+			return
+		}
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			rw.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+		// The stream outlives the server's write timeout.
+		_ = http.NewResponseController(rw).SetWriteDeadline(time.Time{})
+		events, cancel := loop.Subscribe()
+		defer cancel()
+
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				data, _ := json.Marshal(ev)
+				if _, err := fmt.Fprintf(rw, "data: %s\n\n", data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
@@ -0,0 +1,344 @@
+package lang
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+//go:embed schema.json
+var schema []byte
+
+// SchemaHandler serves the JSON Schema of the command format accepted by
+// Parser.ParseJSON.
+func SchemaHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/schema+json")
+		_, _ = rw.Write(schema)
+	})
+}
+
+// jsonOp lists the fields a JSON command accepts besides "op".
+type jsonOp struct {
+	required []string
+	optional []string
+}
+
+var jsonOps = map[string]jsonOp{
+	"white":  {},
+	"green":  {},
+	"update": {},
+	"reset":  {},
+	"bgrect": {required: []string{"x1", "y1", "x2", "y2"}},
+	"figure": {required: []string{"x", "y"}, optional: []string{"color", "size", "rotate", "outline", "opacity", "blend"}},
+	"move":   {required: []string{"x", "y"}},
+	"border": {optional: []string{"color"}},
+
+	"circle":    {required: []string{"x", "y", "r"}, optional: shapeArgs},
+	"ellipse":   {required: []string{"x", "y", "rx", "ry"}, optional: shapeArgs},
+	"line":      {required: []string{"x1", "y1", "x2", "y2"}, optional: shapeArgs[1:]},
+	"polyline":  {required: []string{"points"}, optional: shapeArgs[1:]},
+	"polygon":   {required: []string{"points"}, optional: shapeArgs},
+	"text":      {required: []string{"x", "y", "text"}, optional: textArgs},
+	"sprite":    {required: []string{"name", "x", "y"}, optional: []string{"w", "h", "id", "opacity", "blend"}},
+	"moveshape": {required: []string{"id", "dx", "dy"}},
+}
+
+// ParseJSON reads a JSON array of command objects such as
+// {"op":"figure","x":400,"y":400,"color":"#ff0"} and translates them into the
+// same operations Parse produces for the equivalent script. Every invalid
+// element is reported in the returned ErrorList.
+func (p *Parser) ParseJSON(in io.Reader) ([]painter.Operation, error) {
+	var elems []json.RawMessage
+	rd := &readErr{r: in}
+	if err := json.NewDecoder(rd).Decode(&elems); err != nil {
+		if rd.err != nil && rd.err != io.EOF {
+			return nil, rd.err
+		}
+		return nil, ErrorList{{Message: fmt.Sprintf("body must be a JSON array of commands: %s", err)}}
+	}
+	if p.MaxLines > 0 && len(elems) > p.MaxLines {
+		return nil, fmt.Errorf("%w: the limit is %d", ErrTooManyLines, p.MaxLines)
+	}
+
+	var (
+		res  []painter.Operation
+		errs ErrorList
+	)
+	for i, raw := range elems {
+		jc := jsonCommand{element: i + 1, size: p.size(), errs: &errs}
+		if op := jc.build(raw); op != nil {
+			res = append(res, op)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return res, nil
+}
+
+// readErr remembers the error of the underlying reader, so that it is not
+// mistaken for a JSON syntax error.
+type readErr struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErr) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+type jsonCommand struct {
+	element int
+	size    image.Point
+	op      string
+	fields  map[string]any
+	errs    *ErrorList
+}
+
+func (jc *jsonCommand) errorf(token, format string, args ...any) {
+	jc.errs.add(&ParseError{
+		Element: jc.element,
+		Command: jc.op,
+		Token:   token,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (jc *jsonCommand) build(raw json.RawMessage) painter.Operation {
+	if err := json.Unmarshal(raw, &jc.fields); err != nil || jc.fields == nil {
+		jc.errorf("", "command must be a JSON object")
+		return nil
+	}
+	op, ok := jc.fields["op"].(string)
+	if !ok {
+		jc.errorf("op", "missing string field \"op\"")
+		return nil
+	}
+	jc.op = op
+	spec, ok := jsonOps[op]
+	if !ok {
+		jc.errorf("op", "unknown command: %s", op)
+		return nil
+	}
+
+	valid := true
+	known := map[string]bool{"op": true}
+	for _, name := range spec.required {
+		known[name] = true
+		if _, ok := jc.fields[name]; !ok {
+			jc.errorf(name, "missing field %q", name)
+			valid = false
+		}
+	}
+	for _, name := range spec.optional {
+		known[name] = true
+	}
+	var unknown []string
+	for name := range jc.fields {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		jc.errorf(name, "unknown field %q", name)
+		valid = false
+	}
+	if !valid {
+		return nil
+	}
+
+	switch op {
+	case "white":
+		return painter.FillBackground{Color: color.RGBA{255, 255, 255, 255}}
+
+	case "green":
+		return painter.FillBackground{Color: color.RGBA{0, 128, 0, 255}}
+
+	case "update":
+		return painter.UpdateOp
+
+	case "reset":
+		return painter.Reset{}
+
+	case "bgrect":
+		x1, ok1 := jc.number("x1")
+		y1, ok2 := jc.number("y1")
+		x2, ok3 := jc.number("x2")
+		y2, ok4 := jc.number("y2")
+		if !ok1 || !ok2 || !ok3 || !ok4 {
+			return nil
+		}
+		w, h := float64(jc.size.X), float64(jc.size.Y)
+		r := image.Rect(int(x1*w), int(y1*h), int(x2*w), int(y2*h))
+		return painter.BgRect{Rect: r}
+
+	case "figure":
+		x, okX := jc.number("x")
+		y, okY := jc.number("y")
+		c, okC := jc.color("color", color.RGBA{255, 255, 0, 255})
+		fig := painter.DrawT180{
+			PosX:  int(math.Round(x)),
+			PosY:  int(math.Round(y)),
+			Size:  100,
+			Color: c,
+		}
+		valid := okX && okY && okC
+		if _, ok := jc.fields["size"]; ok {
+			size, ok := jc.number("size")
+			limit := painter.MaxFigureSize(jc.size)
+			if fig.Size = int(math.Round(size)); ok && fig.Size <= 0 {
+				jc.errorf("size", "size must be positive, got %d", fig.Size)
+				ok = false
+			} else if ok && fig.Size > limit {
+				jc.errorf("size", "size must be at most %d, got %d", limit, fig.Size)
+				ok = false
+			}
+			valid = valid && ok
+		}
+		if _, ok := jc.fields["rotate"]; ok {
+			var okR bool
+			fig.Rotate, okR = jc.number("rotate")
+			valid = valid && okR
+		}
+		if _, ok := jc.fields["outline"]; ok {
+			var okO bool
+			fig.Outline, fig.OutlineWidth, okO = jc.outline("outline")
+			valid = valid && okO
+		}
+		var okComp bool
+		fig.Opacity, fig.Blend, okComp = jc.composite()
+		valid = valid && okComp
+		if !valid {
+			return nil
+		}
+		return fig
+
+	case "move":
+		x, okX := jc.number("x")
+		y, okY := jc.number("y")
+		if !okX || !okY {
+			return nil
+		}
+		return painter.Move{NewPos: image.Pt(int(math.Round(x)), int(math.Round(y)))}
+
+	case "border":
+		c, ok := jc.color("color", color.RGBA{0, 0, 0, 255})
+		if !ok {
+			return nil
+		}
+		return painter.Border{Thickness: 10, Color: c}
+
+	case "circle", "ellipse", "line", "polyline", "polygon":
+		return jc.shape()
+
+	case "text":
+		return jc.text()
+
+	case "sprite":
+		return jc.sprite()
+
+	case "moveshape":
+		return jc.moveShape()
+	}
+	return nil
+}
+
+func (jc *jsonCommand) number(name string) (float64, bool) {
+	v, ok := jc.fields[name].(float64)
+	if !ok {
+		jc.errorf(name, "field %q must be a number", name)
+	}
+	return v, ok
+}
+
+func (jc *jsonCommand) color(name string, def color.RGBA) (color.RGBA, bool) {
+	v, ok := jc.fields[name]
+	if !ok {
+		return def, true
+	}
+	s, ok := v.(string)
+	if !ok {
+		jc.errorf(name, "field %q must be a string", name)
+		return def, false
+	}
+	c, err := ParseColor(s)
+	if err != nil {
+		jc.errorf(name, "%s", err)
+		return def, false
+	}
+	return c, true
+}
+
+// composite reads the opacity and blend fields; opacity is left zero, which
+// stands for 1, if not given.
+func (jc *jsonCommand) composite() (float64, painter.Blend, bool) {
+	var (
+		opacity float64
+		blend   painter.Blend
+	)
+	ok := true
+	if _, has := jc.fields["opacity"]; has {
+		opacity, has = jc.number("opacity")
+		if err := painter.CheckOpacity(opacity); has && err != nil {
+			jc.errorf("opacity", "%s", err)
+			has = false
+		}
+		ok = ok && has
+	}
+	if v, has := jc.fields["blend"]; has {
+		s, isString := v.(string)
+		if blend = painter.Blend(s); !isString || painter.CheckBlend(blend) != nil {
+			jc.errorf("blend", "field \"blend\" must be normal, multiply or screen")
+			ok = false
+		}
+	}
+	return opacity, blend, ok
+}
+
+// outline reads an {"color": ..., "width": ...} object; the width defaults
+// to 1.
+func (jc *jsonCommand) outline(name string) (color.RGBA, int, bool) {
+	obj, ok := jc.fields[name].(map[string]any)
+	if !ok {
+		jc.errorf(name, "field %q must be an object with color and width", name)
+		return color.RGBA{}, 0, false
+	}
+	for key := range obj {
+		if key != "color" && key != "width" {
+			jc.errorf(name, "unknown field %q in %s", key, name)
+			return color.RGBA{}, 0, false
+		}
+	}
+	outer := jc.fields
+	defer func() { jc.fields = outer }()
+	jc.fields = obj
+	c, ok := jc.color("color", color.RGBA{0, 0, 0, 255})
+	width := 1.0
+	if _, has := obj["width"]; has {
+		var okW bool
+		limit := painter.MaxFigureSize(jc.size)
+		if width, okW = jc.number("width"); okW && math.Round(width) <= 0 {
+			jc.errorf("width", "outline width must be positive, got %v", width)
+			okW = false
+		} else if okW && math.Round(width) > float64(limit) {
+			jc.errorf("width", "outline width must be at most %d, got %v", limit, width)
+			okW = false
+		}
+		ok = ok && okW
+	}
+	return c, int(math.Round(width)), ok
+}
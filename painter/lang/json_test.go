@@ -0,0 +1,172 @@
+package lang_test
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+func TestParser_ParseJSON(t *testing.T) {
+	p := lang.Parser{}
+
+	t.Run("matches text script", func(t *testing.T) {
+		body := `[
+			{"op": "white"},
+			{"op": "bgrect", "x1": 0.25, "y1": 0.25, "x2": 0.75, "y2": 0.75},
+			{"op": "figure", "x": 400, "y": 400},
+			{"op": "move", "x": 500, "y": 500},
+			{"op": "border", "color": "green"},
+			{"op": "update"}
+		]`
+		got, err := p.ParseJSON(strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := p.Parse(strings.NewReader("white\nbgrect 0.25 0.25 0.75 0.75\nfigure 400 400\nmove 500 500\nupdate\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want[:4], painter.Border{Thickness: 10, Color: color.RGBA{0, 255, 0, 255}}, want[4])
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseJSON() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("figure color", func(t *testing.T) {
+		got, err := p.ParseJSON(strings.NewReader(`[{"op":"figure","x":400,"y":300,"color":"#ff0"}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []painter.Operation{
+			painter.DrawT180{PosX: 400, PosY: 300, Size: 100, Color: color.RGBA{255, 255, 0, 255}},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseJSON() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("figure style", func(t *testing.T) {
+		got, err := p.ParseJSON(strings.NewReader(`[{"op":"figure","x":400,"y":400,"size":150,"color":"#f00","rotate":90,"outline":{"color":"black","width":3}}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := p.Parse(strings.NewReader("figure 400 400 size=150 color=#f00 rotate=90 outline=black:3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseJSON() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("shapes", func(t *testing.T) {
+		got, err := p.ParseJSON(strings.NewReader(`[
+			{"op": "circle", "x": 100, "y": 100, "r": 20},
+			{"op": "ellipse", "x": 100, "y": 100, "rx": 20, "ry": 10, "fill": "red", "stroke": "blue", "width": 2, "id": "e"},
+			{"op": "line", "x1": 0, "y1": 0, "x2": 10, "y2": 10},
+			{"op": "polyline", "points": [{"x": 0, "y": 0}, {"x": 5, "y": 5}], "width": 3},
+			{"op": "polygon", "points": [{"x": 0, "y": 0}, {"x": 5, "y": 0}, {"x": 5, "y": 5}], "fill": "#0f0"},
+			{"op": "text", "x": 5, "y": 5, "text": "Hi \"there\"", "size": 20, "color": "white", "align": "right"},
+			{"op": "moveshape", "id": "e", "dx": 1, "dy": -1}
+		]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := p.Parse(strings.NewReader("circle 100 100 20\n" +
+			"ellipse 100 100 20 10 fill=red stroke=blue width=2 id=e\n" +
+			"line 0 0 10 10\n" +
+			"polyline 0 0 5 5 width=3\n" +
+			"polygon 0 0 5 0 5 5 fill=#0f0\n" +
+			"text 5 5 \"Hi \\\"there\\\"\" size=20 color=white align=right\n" +
+			"moveshape e 1 -1\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseJSON() = %+v, want %+v", got, want)
+		}
+
+		for _, body := range []string{
+			`[{"op": "circle", "x": 1, "y": 1, "r": -1}]`,
+			`[{"op": "circle", "x": 400, "y": 400, "r": 2000000000}]`,
+			`[{"op": "ellipse", "x": 4000, "y": 0, "rx": 10, "ry": 10}]`,
+			`[{"op": "polygon", "points": [{"x": 0, "y": 0}, {"x": 10, "y": 0}, {"x": 10, "y": -100000}]}]`,
+			`[{"op": "line", "x1": 0, "y1": 0, "x2": 1, "y2": 1, "width": 100000}]`,
+			`[{"op": "figure", "x": 400, "y": 400, "size": 200000000}]`,
+			`[{"op": "figure", "x": 1, "y": 1, "outline": {"width": 5000}}]`,
+			`[{"op": "line", "x1": 0, "y1": 0, "x2": 1, "y2": 1, "fill": "red"}]`,
+			`[{"op": "polygon", "points": [{"x": 0, "y": 0}, {"x": 1, "y": 1}]}]`,
+			`[{"op": "polyline", "points": [{"x": 0}, {"x": 1, "y": 1}]}]`,
+			`[{"op": "moveshape", "id": 7, "dx": 1, "dy": 1}]`,
+			`[{"op": "text", "x": 1, "y": 1, "text": ""}]`,
+			`[{"op": "text", "x": 1, "y": 1, "text": "a", "align": "top"}]`,
+			`[{"op": "text", "x": 1, "y": 1, "text": "a", "size": 1000000}]`,
+			`[{"op": "sprite", "name": "logo", "x": 1, "y": 1, "w": 200000, "h": 200000}]`,
+		} {
+			if _, err := p.ParseJSON(strings.NewReader(body)); err == nil {
+				t.Errorf("ParseJSON(%s) succeeded, want an error", body)
+			}
+		}
+	})
+
+	t.Run("per-element errors", func(t *testing.T) {
+		body := `[
+			{"op": "move", "x": 1, "y": 2},
+			{"op": "figure", "x": "400", "color": "#zzz"},
+			{"op": "spin"},
+			{"x": 1},
+			42,
+			{"op": "reset", "force": true}
+		]`
+		_, err := p.ParseJSON(strings.NewReader(body))
+		var errs lang.ErrorList
+		if !errors.As(err, &errs) {
+			t.Fatalf("ParseJSON() error = %v, want lang.ErrorList", err)
+		}
+		want := lang.ErrorList{
+			{Element: 2, Command: "figure", Token: "y", Message: `missing field "y"`},
+			{Element: 3, Command: "spin", Token: "op", Message: "unknown command: spin"},
+			{Element: 4, Token: "op", Message: `missing string field "op"`},
+			{Element: 5, Message: "command must be a JSON object"},
+			{Element: 6, Command: "reset", Token: "force", Message: `unknown field "force"`},
+		}
+		if len(errs) != len(want) {
+			t.Fatalf("got %d errors, want %d:\n%v", len(errs), len(want), errs)
+		}
+		for i := range want {
+			if *errs[i] != *want[i] {
+				t.Errorf("error %d = %+v, want %+v", i, *errs[i], *want[i])
+			}
+		}
+	})
+
+	t.Run("field types", func(t *testing.T) {
+		_, err := p.ParseJSON(strings.NewReader(`[{"op":"figure","x":"400","y":1,"color":"#zzz"}]`))
+		want := "element 1: figure: field \"x\" must be a number\nelement 1: figure: invalid color \"#zzz\""
+		if err == nil || err.Error() != want {
+			t.Errorf("ParseJSON() error = %v, want %q", err, want)
+		}
+	})
+
+	t.Run("not an array", func(t *testing.T) {
+		if _, err := p.ParseJSON(strings.NewReader(`{"op":"white"}`)); err == nil {
+			t.Error("ParseJSON() accepted an object")
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		got, err := p.ParseJSON(strings.NewReader(`[{"op":"move","x":10.4,"y":-3}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []painter.Operation{painter.Move{NewPos: image.Pt(10, -3)}}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseJSON() = %+v, want %+v", got, want)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package lang
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTooManyLines is returned by the Parser for scripts longer than its
+	// MaxLines.
+	ErrTooManyLines = errors.New("script has too many lines")
+	// ErrTooManyOps is returned by the Parser for scripts whose loops expand
+	// to more than MaxLines operations.
+	ErrTooManyOps = errors.New("script expands to too many operations")
+)
+
+// DefaultRate and DefaultBurst are the limits of the painter unless it is
+// told otherwise. The rate leaves room for the example animations, which
+// post over 200 commands per second.
+const (
+	DefaultRate  = 500
+	DefaultBurst = 2000
+)
+
+// Limiter protects the loops from clients that send too much: it caps
+// request bodies and lets each client post Rate commands per second on
+// average, in bursts of up to Burst commands. Scripts with more than Burst
+// commands are refused. Clients are told apart by
+// their token when the request passed Tokens.Authenticate, and by IP
+// address otherwise.
+type Limiter struct {
+	// MaxBody is the largest accepted request body in bytes. Zero means
+	// no limit.
+	MaxBody int64
+	// Rate is the number of commands per second a client may post. Zero
+	// means no limit.
+	Rate  float64
+	Burst int
+	// Now returns the time commands are charged at, time.Now if nil.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// bucket is a token bucket. Its tokens may go negative when a script has
+// more commands than are left, by less than Burst; the client then waits
+// until it is refilled.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type limiterKey struct{}
+
+// Limit applies the limits to every request handled by h. The handlers of
+// this package then charge the posted commands to the client. A nil
+// Limiter lets every request through.
+func (l *Limiter) Limit(h http.Handler) http.Handler {
+	if l == nil {
+		return h
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if l.MaxBody > 0 {
+			r.Body = http.MaxBytesReader(rw, r.Body, l.MaxBody)
+		}
+		h.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), limiterKey{}, l)))
+	})
+}
+
+// take charges n commands to the client of the request and responds with
+// 429 if it is over its rate.
+func take(rw http.ResponseWriter, r *http.Request, n int) bool {
+	l, ok := r.Context().Value(limiterKey{}).(*Limiter)
+	if !ok || l.Rate <= 0 {
+		return true
+	}
+	client := clientKey(r)
+	if !l.fits(n) {
+		log.Printf("Refused %s %s from %s: %d commands, burst is %d", r.Method, r.URL.Path, client, n, l.Burst)
+		http.Error(rw, l.tooManyMessage(n), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	wait := l.take(client, n, l.now())
+	if wait <= 0 {
+		return true
+	}
+	secs := int(math.Ceil(wait.Seconds()))
+	log.Printf("Rate limited %s %s from %s for %ds", r.Method, r.URL.Path, client, secs)
+	rw.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(rw, "too many commands, slow down", http.StatusTooManyRequests)
+	return false
+}
+
+// fits reports whether a script of n commands can ever be posted, which
+// it cannot if it is larger than a burst.
+func (l *Limiter) fits(n int) bool {
+	return n <= max(l.Burst, 1)
+}
+
+func (l *Limiter) tooManyMessage(n int) string {
+	return fmt.Sprintf("script posts %d commands, more than the burst of %d", n, max(l.Burst, 1))
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now == nil {
+		return time.Now()
+	}
+	return l.Now()
+}
+
+// take charges n commands to client at now, or returns how long the client
+// has to wait before it may post again.
+func (l *Limiter) take(client string, n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	burst := float64(max(l.Burst, 1))
+	if l.buckets == nil {
+		l.buckets = map[string]*bucket{}
+	}
+	// Forget clients whose buckets have been refilled.
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.Rate >= burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	}
+	b.tokens -= float64(n)
+	return 0
+}
+
+func clientKey(r *http.Request) string {
+	if tok, ok := r.Context().Value(tokenKey{}).(*Token); ok {
+		return "token " + tok.ID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tooLarge reports whether err means the request was over a size limit.
+func tooLarge(err error) bool {
+	var mbe *http.MaxBytesError
+	return errors.As(err, &mbe) || errors.Is(err, ErrTooManyLines) || errors.Is(err, ErrTooManyOps) || errors.Is(err, bufio.ErrTooLong)
+}
+
+func tooLargeMessage(err error) string {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return fmt.Sprintf("request body is larger than %d bytes", mbe.Limit)
+	}
+	return err.Error()
+}
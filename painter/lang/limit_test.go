@@ -0,0 +1,82 @@
+package lang_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+func TestLimiter(t *testing.T) {
+	loop := &painter.Loop{}
+	loop.Start(nil)
+	defer loop.StopAndWait()
+
+	limiter := &lang.Limiter{MaxBody: 64, Rate: 0.1, Burst: 3}
+	handler := limiter.Limit(lang.HttpHandler(loop, &lang.Parser{MaxLines: 4}))
+
+	post := func(from, contentType, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.RemoteAddr = from + ":40000"
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("body size", func(t *testing.T) {
+		w := post("10.0.0.1", "text/plain", strings.Repeat("update\n", 20))
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+		}
+		w = post("10.0.0.1", "application/json", `[`+strings.Repeat(`{"op":"update"},`, 10)+`{"op":"update"}]`)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("JSON: status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+		}
+	})
+
+	t.Run("lines", func(t *testing.T) {
+		w := post("10.0.0.1", "text/plain", "white\nwhite\nwhite\nwhite\nupdate\n")
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+		}
+		w = post("10.0.0.1", "application/json", `[{"op":"white"},{"op":"white"},{"op":"white"},{"op":"white"},{"op":"update"}]`)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("JSON: status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+		}
+		// Loops count as the operations they expand to.
+		w = post("10.0.0.1", "text/plain", "repeat 100000 {\n  white\n}\n")
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("loop: status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+		}
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		if w := post("10.0.0.2", "text/plain", "white\nupdate\n"); w.Code != http.StatusOK {
+			t.Fatalf("first script: status = %d, want %d", w.Code, http.StatusOK)
+		}
+		// The bucket goes into debt rather than rejecting a script larger
+		// than what is left.
+		if w := post("10.0.0.2", "text/plain", "white\nwhite\nupdate\n"); w.Code != http.StatusOK {
+			t.Fatalf("second script: status = %d, want %d", w.Code, http.StatusOK)
+		}
+		w := post("10.0.0.2", "text/plain", "update\n")
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("third script: status = %d, want %d", w.Code, http.StatusTooManyRequests)
+		}
+		if got := w.Header().Get("Retry-After"); got != "30" {
+			t.Errorf("Retry-After = %q, want %q", got, "30")
+		}
+		if w := post("10.0.0.3", "text/plain", "update\n"); w.Code != http.StatusOK {
+			t.Errorf("another client: status = %d, want %d", w.Code, http.StatusOK)
+		}
+		// A script larger than a burst could never be paid for.
+		w = post("10.0.0.4", "text/plain", "white\nwhite\nwhite\nupdate\n")
+		if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "more than the burst of 3") {
+			t.Errorf("script over the burst: status = %d, %s", w.Code, w.Body)
+		}
+	})
+}
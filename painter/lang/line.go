@@ -0,0 +1,199 @@
+package lang
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// LineServer serves the line protocol: newline-delimited commands posted to
+// Loop and answered with "ok" or "err <message>".
+type LineServer struct {
+	Loop   *painter.Loop
+	Parser *Parser
+	// Tokens, if set, require every connection to start with an
+	// "auth <secret>" line. Its commands are then checked against the
+	// scopes of the token, as on the HTTP API.
+	Tokens *Tokens
+	// Limiter, if set, caps the size of every command or block at MaxBody
+	// and charges the posted commands to the token or the remote host.
+	Limiter *Limiter
+	// IdleTimeout, if positive, closes connections that send no line for
+	// that long, so that idle and half-open clients do not hold them.
+	IdleTimeout time.Duration
+}
+
+// Serve accepts connections on l and serves each of them with ServeConn until
+// the listener is closed.
+func (s *LineServer) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := s.ServeConn(conn); err != nil {
+				log.Printf("Line connection %s: %s", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// ServeConn reads newline-delimited commands from rw, posts them to the loop
+// and answers every command with "ok" or "err <message>" on its own line.
+// Lines of a repeat or for block are collected until the block is closed and
+// then answered once. IdleTimeout applies if rw has a read deadline, as
+// network connections do.
+func (s *LineServer) ServeConn(rw io.ReadWriter) error {
+	scanner := bufio.NewScanner(rw)
+	w := bufio.NewWriter(rw)
+	conn, hasDeadline := rw.(interface{ SetReadDeadline(time.Time) error })
+	scan := func() bool {
+		if hasDeadline && s.IdleTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+		return scanner.Scan()
+	}
+
+	var (
+		chunk strings.Builder
+		depth int
+		tok   *Token
+		// tooLarge is set when the chunk went over MaxBody. The rest of
+		// the block is skipped.
+		tooLarge bool
+	)
+	for scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if depth == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+
+		if depth == 0 && (tok == nil || strings.HasPrefix(trimmed, "auth ")) {
+			var err error
+			if tok, err = s.auth(trimmed); err != nil {
+				_, _ = fmt.Fprintf(w, "err %s\n", err)
+				_ = w.Flush()
+				return fmt.Errorf("rejected: %w", err)
+			}
+			if strings.HasPrefix(trimmed, "auth ") {
+				_, _ = w.WriteString("ok\n")
+				if err := w.Flush(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if !tooLarge {
+			chunk.WriteString(line)
+			chunk.WriteByte('\n')
+		}
+		if l := s.Limiter; l != nil && l.MaxBody > 0 && int64(chunk.Len()) > l.MaxBody {
+			tooLarge = true
+			chunk.Reset()
+		}
+
+		if strings.HasSuffix(trimmed, "{") {
+			depth++
+		} else if trimmed == "}" && depth > 0 {
+			depth--
+		}
+		if depth > 0 {
+			continue
+		}
+
+		var (
+			cmds []painter.Operation
+			err  error
+		)
+		if tooLarge {
+			err = fmt.Errorf("command is larger than %d bytes", s.Limiter.MaxBody)
+		} else {
+			cmds, err = s.Parser.Parse(strings.NewReader(chunk.String()))
+		}
+		chunk.Reset()
+		tooLarge = false
+		if err == nil {
+			err = tok.check(scriptScopes(cmds))
+		}
+		if err == nil {
+			err = s.charge(rw, tok, len(cmds))
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "err %s\n", strings.ReplaceAll(err.Error(), "\n", "; "))
+		} else {
+			for _, cmd := range cmds {
+				s.Loop.Post(cmd)
+			}
+			_, _ = w.WriteString("ok\n")
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	err := scanner.Err()
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		_, _ = fmt.Fprintf(w, "err idle for %s, closing\n", s.IdleTimeout)
+		_ = w.Flush()
+		return fmt.Errorf("idle for %s", s.IdleTimeout)
+	}
+	return err
+}
+
+// charge charges n commands to the client of a connection, which is its
+// token or its remote host, and returns an error if it is over its rate.
+func (s *LineServer) charge(rw io.ReadWriter, tok *Token, n int) error {
+	l := s.Limiter
+	if l == nil || l.Rate <= 0 {
+		return nil
+	}
+	if !l.fits(n) {
+		return errors.New(l.tooManyMessage(n))
+	}
+	client := "line"
+	if s.Tokens != nil {
+		client = "token " + tok.ID
+	} else if conn, ok := rw.(net.Conn); ok && conn.RemoteAddr() != nil {
+		client = conn.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(client); err == nil {
+			client = host
+		}
+	}
+	if wait := l.take(client, n, l.now()); wait > 0 {
+		return fmt.Errorf("too many commands, slow down; retry in %ds", int(math.Ceil(wait.Seconds())))
+	}
+	return nil
+}
+
+// auth returns the token of an "auth <secret>" line. Without Tokens every
+// line is let through, auth lines included, with the all-powerful
+// openToken.
+func (s *LineServer) auth(line string) (*Token, error) {
+	if s.Tokens == nil {
+		return openToken, nil
+	}
+	secret, ok := strings.CutPrefix(line, "auth ")
+	if !ok {
+		return nil, errors.New("authenticate first with auth <token>")
+	}
+	tok := s.Tokens.lookup(secret)
+	if tok == nil {
+		return nil, errors.New("unknown token")
+	}
+	return tok, nil
+}
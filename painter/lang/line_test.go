@@ -0,0 +1,168 @@
+package lang_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+	"github.com/roman-mazur/architecture-lab-3/painter/lang"
+)
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	s := &lang.LineServer{Loop: &painter.Loop{}, Parser: &lang.Parser{}}
+	go func() { done <- s.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	replies := bufio.NewScanner(conn)
+
+	tests := []struct {
+		send string
+		want string
+	}{
+		{send: "white\n", want: "ok"},
+		// Without tokens, auth lines are accepted and ignored.
+		{send: "auth anything\n", want: "ok"},
+		{send: "\n# comment\nfigure 400 400\n", want: "ok"},
+		{send: "move 1 x\n", want: "err line 1, column 8: move: undefined variable: x"},
+		{send: "repeat 2 {\n  move i*10 0\n}\n", want: "ok"},
+		{send: "foo\n", want: "err line 1, column 1: unknown command: foo"},
+		{send: "figure a b\n", want: "err line 1, column 8: figure: undefined variable: a; line 1, column 10: figure: undefined variable: b"},
+	}
+	for _, tt := range tests {
+		if _, err := conn.Write([]byte(tt.send)); err != nil {
+			t.Fatal(err)
+		}
+		if !replies.Scan() {
+			t.Fatalf("no reply to %q: %v", tt.send, replies.Err())
+		}
+		if got := replies.Text(); got != tt.want {
+			t.Errorf("reply to %q = %q, want %q", strings.TrimSpace(tt.send), got, tt.want)
+		}
+	}
+
+	l.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Serve() = %v after close", err)
+	}
+}
+
+func TestLineServer_Tokens(t *testing.T) {
+	ts, err := lang.ParseTokens(strings.NewReader(testTokens))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop := &painter.Loop{}
+	loop.Start(nil)
+	defer loop.StopAndWait()
+	s := &lang.LineServer{Loop: loop, Parser: &lang.Parser{}, Tokens: ts}
+
+	for _, tc := range []struct {
+		name, send string
+		want       []string
+		// rejected is whether the connection is closed early.
+		rejected bool
+	}{
+		{"no auth", "figure 1 1\nwhite\n", []string{"err authenticate first with auth <token>"}, true},
+		{"unknown token", "auth guess\nwhite\n", []string{"err unknown token"}, true},
+		{"read only", "auth view-secret\nwhite\n", []string{"ok", "err token lacks the draw scope"}, false},
+		{"draw", "auth draw-secret\nwhite\nrepeat 2 {\n  figure 1 1\n}\n", []string{"ok", "ok", "ok"}, false},
+		{"reset", "auth draw-secret\nreset\nupdate\n", []string{"ok", "ok", "ok"}, false},
+		{"bad auth later", "auth draw-secret\nauth guess\nwhite\n", []string{"ok", "err unknown token"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out strings.Builder
+			err := s.ServeConn(struct {
+				io.Reader
+				io.Writer
+			}{strings.NewReader(tc.send), &out})
+			got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("replies = %q, want %q", got, tc.want)
+			}
+			if (err != nil) != tc.rejected {
+				t.Errorf("ServeConn() = %v, want an error: %t", err, tc.rejected)
+			}
+		})
+	}
+}
+
+func TestLineServer_Limiter(t *testing.T) {
+	loop := &painter.Loop{}
+	loop.Start(nil)
+	defer loop.StopAndWait()
+	s := &lang.LineServer{Loop: loop, Parser: &lang.Parser{}, Limiter: &lang.Limiter{MaxBody: 32, Rate: 0.1, Burst: 3}}
+
+	send := "repeat 1 {\n" + strings.Repeat("  white\n", 10) + "}\n" +
+		"repeat 4 {\n  white\n}\n" +
+		"white\n" +
+		"repeat 2 {\n  white\n}\n" +
+		"white\n"
+	var out strings.Builder
+	if err := s.ServeConn(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(send), &out}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"err command is larger than 32 bytes",
+		"err script posts 4 commands, more than the burst of 3",
+		"ok",
+		"ok",
+		"err too many commands, slow down; retry in 10s",
+	}
+	if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); !slices.Equal(got, want) {
+		t.Errorf("replies = %q, want %q", got, want)
+	}
+}
+
+func TestLineServer_IdleTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := &lang.LineServer{Loop: &painter.Loop{}, Parser: &lang.Parser{}, IdleTimeout: 50 * time.Millisecond}
+	go func() { _ = s.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	replies := bufio.NewScanner(conn)
+
+	// Every line restarts the timeout.
+	for range 3 {
+		time.Sleep(30 * time.Millisecond)
+		if _, err := conn.Write([]byte("white\n")); err != nil {
+			t.Fatal(err)
+		}
+		if !replies.Scan() || replies.Text() != "ok" {
+			t.Fatalf("reply = %q, %v, want ok", replies.Text(), replies.Err())
+		}
+	}
+
+	var got []string
+	for replies.Scan() {
+		got = append(got, replies.Text())
+	}
+	if want := []string{"err idle for 50ms, closing"}; !slices.Equal(got, want) || replies.Err() != nil {
+		t.Errorf("replies of an idle connection = %q, %v, want %q and EOF", got, replies.Err(), want)
+	}
+}
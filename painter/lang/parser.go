@@ -6,122 +6,606 @@ import (
 	"image"
 	"image/color"
 	"io"
+	"math"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/roman-mazur/architecture-lab-3/painter"
 )
 
-type Parser struct{}
+// maxIterations bounds the total number of loop iterations in one script so
+// that a typo in a range cannot hang the server.
+const maxIterations = 100000
 
+type Parser struct {
+	// Size is the canvas size bgrect fractions are relative to,
+	// painter.DefaultSize if not set.
+	Size image.Point
+	// MaxLines limits the number of lines of a script, or commands of a
+	// JSON array, and the number of operations a script expands to, so
+	// that a loop on one line cannot get around it. Zero means no limit.
+	MaxLines int
+}
+
+// Parse reads a script and expands variables, expressions and loops into a
+// flat list of operations. If the script has errors, Parse keeps going and
+// returns all of them as an ErrorList.
 func (p *Parser) Parse(in io.Reader) ([]painter.Operation, error) {
-	var res []painter.Operation
+	var lines []string
 	scanner := bufio.NewScanner(in)
-
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+		if p.MaxLines > 0 && len(lines) == p.MaxLines {
+			return nil, fmt.Errorf("%w: the limit is %d", ErrTooManyLines, p.MaxLines)
 		}
-		fmt.Println(">> received command:", line)
-		fields := strings.Fields(line)
-		if len(fields) == 0 {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sp := scriptParser{lines: lines}
+	stmts := sp.block(0)
+
+	x := executor{vars: env{}, errs: sp.errs, size: p.size(), maxOps: p.MaxLines}
+	if !x.run(stmts) && x.tooMany {
+		return nil, fmt.Errorf("%w: the limit is %d", ErrTooManyOps, p.MaxLines)
+	}
+	if len(x.errs) > 0 {
+		sort.SliceStable(x.errs, func(i, j int) bool {
+			a, b := x.errs[i], x.errs[j]
+			return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+		})
+		return nil, x.errs
+	}
+	return x.res, nil
+}
+
+func (p *Parser) size() image.Point {
+	if p.Size == (image.Point{}) {
+		return painter.DefaultSize
+	}
+	return p.Size
+}
+
+// field is a whitespace-separated word of a script line with its 1-based
+// column. Quoted strings are single fields, quotes and escapes included.
+type field struct {
+	text string
+	col  int
+}
+
+func splitFields(line string) []field {
+	var res []field
+	start := -1
+	quoted := false
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) && quoted {
+			switch line[i] {
+			case '\\':
+				i = min(i+1, len(line)-1)
+			case '"':
+				quoted = false
+			}
 			continue
 		}
-		cmd := strings.ToLower(fields[0])
+		if i < len(line) && line[i] == '"' {
+			quoted = true
+		}
+		space := i == len(line) || line[i] == ' ' || line[i] == '\t'
+		if space && start >= 0 {
+			res = append(res, field{text: line[start:i], col: start + 1})
+			start = -1
+		} else if !space && start < 0 {
+			start = i
+		}
+	}
+	return res
+}
 
-		switch cmd {
-		case "white":
-			res = append(res, painter.FillBackground{Color: color.RGBA{255, 255, 255, 255}})
+type stmt interface{}
 
-		case "green":
-			res = append(res, painter.FillBackground{Color: color.RGBA{0, 128, 0, 255}})
+type commandStmt struct {
+	line   int
+	fields []field
+}
 
-		case "update":
-			res = append(res, painter.UpdateOp)
+type letStmt struct {
+	line  int
+	name  string
+	value expr
+}
 
-		case "bgrect":
-			if len(fields) != 5 {
-				return nil, fmt.Errorf("bgrect requires 4 arguments")
-			}
-			x1, err := strconv.ParseFloat(fields[1], 64)
-			if err != nil {
-				return nil, err
+type loopStmt struct {
+	line, col      int
+	cmd            string
+	name           string
+	from, to, step expr
+	body           []stmt
+}
+
+type scriptParser struct {
+	lines []string
+	pos   int
+	errs  ErrorList
+}
+
+// block parses statements until the end of input or, when openLine is not
+// zero, until the } that closes the block opened on that line.
+func (sp *scriptParser) block(openLine int) []stmt {
+	var res []stmt
+	for sp.pos < len(sp.lines) {
+		lineNo := sp.pos + 1
+		raw := sp.lines[sp.pos]
+		sp.pos++
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fmt.Println(">> received command:", line)
+		fields := splitFields(raw)
+		cmd := strings.ToLower(fields[0].text)
+
+		switch cmd {
+		case "}":
+			if openLine == 0 {
+				sp.errs.addf(lineNo, "", fields[0], "unexpected }")
+				continue
 			}
-			y1, err := strconv.ParseFloat(fields[2], 64)
-			if err != nil {
-				return nil, err
+			if len(fields) != 1 {
+				sp.errs.addf(lineNo, "", fields[1], "unexpected %q after }", fields[1].text)
 			}
-			x2, err := strconv.ParseFloat(fields[3], 64)
-			if err != nil {
-				return nil, err
+			return res
+
+		case "let":
+			if s, ok := sp.let(lineNo, raw, fields); ok {
+				res = append(res, s)
 			}
-			y2, err := strconv.ParseFloat(fields[4], 64)
-			if err != nil {
-				return nil, err
+
+		case "repeat", "for":
+			s, ok := sp.loopHeader(lineNo, raw, fields)
+			// The body is parsed even for a broken header so that errors
+			// inside it are still reported and the braces stay balanced.
+			body := sp.block(lineNo)
+			if ok {
+				s.body = body
+				res = append(res, s)
 			}
 
-			r := image.Rect(int(x1*800), int(y1*800), int(x2*800), int(y2*800))
-			res = append(res, painter.BgRect{Rect: r})
+		default:
+			res = append(res, commandStmt{line: lineNo, fields: fields})
+		}
+	}
+	if openLine != 0 {
+		sp.errs.add(&ParseError{Line: openLine, Column: 1, Message: "missing } for block opened here"})
+	}
+	return res
+}
 
-		case "figure":
-			if len(fields) != 3 {
-				return nil, fmt.Errorf("figure requires 2 arguments")
-			}
-			x, err := strconv.Atoi(fields[1])
-			if err != nil {
-				return nil, err
-			}
-			y, err := strconv.Atoi(fields[2])
-			if err != nil {
-				return nil, err
-			}
-			res = append(res, painter.DrawT180{
-				PosX:  x,
-				PosY:  y,
-				Size:  100,
-				Color: color.RGBA{255, 255, 0, 255},
-			})
-
-		case "move":
-			if len(fields) != 3 {
-				return nil, fmt.Errorf("move requires 2 arguments")
+// let parses "let name = expr".
+func (sp *scriptParser) let(lineNo int, raw string, fields []field) (letStmt, bool) {
+	eq := strings.Index(raw, "=")
+	if eq < 0 || len(fields) < 2 {
+		sp.errs.addf(lineNo, "let", fields[0], "let requires the form: let name = value")
+		return letStmt{}, false
+	}
+	name := field{text: strings.TrimSpace(raw[fields[0].col+2 : eq]), col: fields[1].col}
+	if !isIdent(name.text) {
+		sp.errs.addf(lineNo, "let", name, "invalid variable name: %q", name.text)
+		return letStmt{}, false
+	}
+	value, err := parseExpr(raw[eq+1:], eq+2)
+	if err != nil {
+		sp.errs.addErr(lineNo, "let", name, err)
+		return letStmt{}, false
+	}
+	return letStmt{line: lineNo, name: name.text, value: value}, true
+}
+
+// loopHeader parses "repeat N [as name] {" and
+// "for name in from..to [step s] {". Ranges exclude their upper bound, so
+// "repeat 10" and "for i in 0..10" visit the same indices.
+func (sp *scriptParser) loopHeader(lineNo int, raw string, fields []field) (loopStmt, bool) {
+	cmd := strings.ToLower(fields[0].text)
+	last := fields[len(fields)-1]
+	if !strings.HasSuffix(last.text, "{") {
+		sp.errs.addf(lineNo, cmd, last, "loop header must end with {")
+		return loopStmt{}, false
+	}
+	// header holds the text between the keyword and the opening brace; off
+	// is the 0-based index of header[0] in raw.
+	off := fields[0].col - 1 + len(fields[0].text)
+	header := raw[off : last.col-1+len(last.text)-1]
+	s := loopStmt{line: lineNo, col: fields[0].col, cmd: cmd, from: numLit(0), step: numLit(1)}
+
+	parse := func(from, to int) (expr, bool) {
+		x, err := parseExpr(header[from:to], off+from+1)
+		if err != nil {
+			sp.errs.addErr(lineNo, cmd, fields[0], err)
+			return nil, false
+		}
+		return x, true
+	}
+
+	var ok bool
+	if cmd == "repeat" {
+		end := len(header)
+		s.name = "i"
+		if as := strings.Index(header, " as "); as >= 0 {
+			end = as
+			s.name = strings.TrimSpace(header[as+4:])
+			if !isIdent(s.name) {
+				sp.errs.addf(lineNo, cmd, field{text: s.name, col: off + as + 5}, "invalid variable name: %q", s.name)
+				return loopStmt{}, false
 			}
-			x, err := strconv.Atoi(fields[1])
+		}
+		if strings.TrimSpace(header[:end]) == "" {
+			sp.errs.addf(lineNo, cmd, fields[0], "repeat requires a count")
+			return loopStmt{}, false
+		}
+		s.to, ok = parse(0, end)
+		return s, ok
+	}
+
+	in := strings.Index(header, " in ")
+	if in < 0 {
+		sp.errs.addf(lineNo, cmd, fields[0], "for requires the form: for name in from..to [step s] {")
+		return loopStmt{}, false
+	}
+	s.name = strings.TrimSpace(header[:in])
+	if !isIdent(s.name) {
+		sp.errs.addf(lineNo, cmd, field{text: s.name, col: fields[1].col}, "invalid variable name: %q", s.name)
+		return loopStmt{}, false
+	}
+	rangeStart, rangeEnd := in+4, len(header)
+	if step := strings.Index(header, " step "); step > in {
+		rangeEnd = step
+		if s.step, ok = parse(step+6, len(header)); !ok {
+			return loopStmt{}, false
+		}
+	}
+	dots := strings.Index(header[rangeStart:rangeEnd], "..")
+	if dots < 0 {
+		sp.errs.addf(lineNo, cmd, field{text: strings.TrimSpace(header[rangeStart:rangeEnd]), col: off + rangeStart + 1}, "for range must be written as from..to")
+		return loopStmt{}, false
+	}
+	dots += rangeStart
+	if s.from, ok = parse(rangeStart, dots); !ok {
+		return loopStmt{}, false
+	}
+	if s.to, ok = parse(dots+2, rangeEnd); !ok {
+		return loopStmt{}, false
+	}
+	return s, true
+}
+
+type executor struct {
+	vars       env
+	size       image.Point
+	res        []painter.Operation
+	errs       ErrorList
+	iterations int
+	// maxOps limits the length of res, if not zero. tooMany is set once it
+	// is reached.
+	maxOps  int
+	tooMany bool
+}
+
+// run evaluates stmts and returns false if evaluation had to stop early.
+func (x *executor) run(stmts []stmt) bool {
+	for _, s := range stmts {
+		switch s := s.(type) {
+		case letStmt:
+			v, err := s.value.eval(x.vars)
 			if err != nil {
-				return nil, err
+				x.errs.addErr(s.line, "let", field{}, err)
+				continue
 			}
-			y, err := strconv.Atoi(fields[2])
-			if err != nil {
-				return nil, err
+			x.vars[s.name] = v
+
+		case loopStmt:
+			if !x.loop(s) {
+				return false
 			}
-			res = append(res, painter.Move{NewPos: image.Point{X: x, Y: y}})
-
-		case "border":
-			var c color.Color = color.Black
-			if len(fields) >= 2 {
-				switch fields[1] {
-				case "green":
-					c = color.RGBA{0, 255, 0, 255}
-				case "white":
-					c = color.White
-				case "red":
-					c = color.RGBA{255, 0, 0, 255}
+
+		case commandStmt:
+			if op := x.command(s.line, s.fields); op != nil {
+				if x.maxOps > 0 && len(x.res) == x.maxOps {
+					x.tooMany = true
+					return false
 				}
+				x.res = append(x.res, op)
 			}
-			res = append(res, painter.Border{Thickness: 10, Color: c})
+		}
+	}
+	return true
+}
 
-		case "reset":
-			res = append(res, painter.Reset{})
+func (x *executor) loop(s loopStmt) bool {
+	var bounds [3]float64
+	for i, e := range []expr{s.from, s.to, s.step} {
+		v, err := e.eval(x.vars)
+		if err != nil {
+			x.errs.addErr(s.line, s.cmd, field{}, err)
+			return true
+		}
+		bounds[i] = v
+	}
+	from, to, step := bounds[0], bounds[1], bounds[2]
+	if step == 0 {
+		x.errs.addf(s.line, s.cmd, field{text: s.cmd, col: s.col}, "loop step must not be zero")
+		return true
+	}
+
+	saved, shadowed := x.vars[s.name]
+	defer func() {
+		if shadowed {
+			x.vars[s.name] = saved
+		} else {
+			delete(x.vars, s.name)
+		}
+	}()
+
+	for v := from; (step > 0 && v < to) || (step < 0 && v > to); v += step {
+		x.iterations++
+		if x.iterations > maxIterations {
+			x.errs.addf(s.line, s.cmd, field{text: s.cmd, col: s.col}, "too many loop iterations (limit %d)", maxIterations)
+			return false
+		}
+		x.vars[s.name] = v
+		if !x.run(s.body) {
+			return false
+		}
+	}
+	return true
+}
+
+func (x *executor) float(line int, cmd string, arg field) (float64, bool) {
+	e, err := parseExpr(arg.text, arg.col)
+	if err == nil {
+		var v float64
+		if v, err = e.eval(x.vars); err == nil {
+			return v, true
+		}
+	}
+	x.errs.addErr(line, cmd, arg, err)
+	return 0, false
+}
+
+func (x *executor) int(line int, cmd string, arg field) (int, bool) {
+	v, ok := x.float(line, cmd, arg)
+	return int(math.Round(v)), ok
+}
+
+// string reads a quoted string with Go escapes.
+func (x *executor) string(line int, cmd string, arg field) (string, bool) {
+	if !strings.HasPrefix(arg.text, `"`) {
+		x.errs.addf(line, cmd, arg, "want a quoted string, got %s", arg.text)
+		return "", false
+	}
+	s, err := strconv.Unquote(arg.text)
+	if err != nil {
+		x.errs.addf(line, cmd, arg, "invalid string %s", arg.text)
+		return "", false
+	}
+	return s, true
+}
+
+func (x *executor) color(line int, cmd string, arg field) (color.RGBA, bool) {
+	c, err := ParseColor(arg.text)
+	if err != nil {
+		x.errs.addf(line, cmd, arg, "%s", err)
+		return c, false
+	}
+	return c, true
+}
+
+// composite reads the opacity and blend arguments; opacity is left zero,
+// which stands for 1, if not given.
+func (x *executor) composite(line int, cmd string, named map[string]field) (float64, painter.Blend, bool) {
+	var (
+		opacity float64
+		blend   painter.Blend
+	)
+	ok := true
+	if f, has := named["opacity"]; has {
+		opacity, has = x.float(line, cmd, f)
+		if err := painter.CheckOpacity(opacity); has && err != nil {
+			x.errs.addf(line, cmd, f, "%s", err)
+			has = false
+		}
+		ok = ok && has
+	}
+	if f, has := named["blend"]; has {
+		if blend = painter.Blend(f.text); painter.CheckBlend(blend) != nil {
+			x.errs.addf(line, cmd, f, "unknown blend mode %q, want normal, multiply or screen", f.text)
+			ok = false
+		}
+	}
+	return opacity, blend, ok
+}
 
+// outline reads a color[:width] value; the width defaults to 1.
+func (x *executor) outline(line int, cmd string, arg field) (color.RGBA, int, bool) {
+	name, width, hasWidth := strings.Cut(arg.text, ":")
+	c, ok := x.color(line, cmd, field{text: name, col: arg.col})
+	w := 1
+	if hasWidth {
+		var okW bool
+		wf := field{text: width, col: arg.col + len(name) + 1}
+		w, okW = x.int(line, cmd, wf)
+		if limit := painter.MaxFigureSize(x.size); okW && w <= 0 {
+			x.errs.addf(line, cmd, wf, "outline width must be positive, got %d", w)
+			okW = false
+		} else if okW && w > limit {
+			x.errs.addf(line, cmd, wf, "outline width must be at most %d, got %d", limit, w)
+			okW = false
+		}
+		ok = ok && okW
+	}
+	return c, w, ok
+}
+
+// splitArgs separates positional arguments from the name=value ones that
+// follow them. The value fields keep their own column. Names other than
+// allowed ones, repeated names and positional arguments after named ones
+// are reported as errors.
+func (x *executor) splitArgs(line int, cmd string, args []field, allowed ...string) ([]field, map[string]field, bool) {
+	var pos []field
+	named := map[string]field{}
+	ok := true
+	for _, arg := range args {
+		name, value, isNamed := strings.Cut(arg.text, "=")
+		isNamed = isNamed && !strings.HasPrefix(arg.text, `"`)
+		switch {
+		case !isNamed && len(named) > 0:
+			x.errs.addf(line, cmd, arg, "positional argument after named ones")
+			ok = false
+		case !isNamed:
+			pos = append(pos, arg)
+		case !slices.Contains(allowed, name):
+			x.errs.addf(line, cmd, arg, "unknown argument %q, want one of %s", name, strings.Join(allowed, ", "))
+			ok = false
+		case value == "":
+			x.errs.addf(line, cmd, arg, "missing value for %s", name)
+			ok = false
 		default:
-			return nil, fmt.Errorf("unknown command: %s", cmd)
+			if _, dup := named[name]; dup {
+				x.errs.addf(line, cmd, arg, "%s given more than once", name)
+				ok = false
+			}
+			named[name] = field{text: value, col: arg.col + len(name) + 1}
 		}
 	}
+	return pos, named, ok
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+// command builds the operation for a single command line. It returns nil
+// if the command has errors; they are recorded in x.errs.
+func (x *executor) command(line int, fields []field) painter.Operation {
+	cmd := strings.ToLower(fields[0].text)
+	args := fields[1:]
+
+	arity := func(n int) bool {
+		if len(args) == n {
+			return true
+		}
+		at := fields[0]
+		if len(args) > n {
+			at = args[n]
+		}
+		x.errs.addf(line, cmd, at, "%s requires %d arguments, got %d", cmd, n, len(args))
+		return false
 	}
 
-	return res, nil
+	switch cmd {
+	case "white":
+		return painter.FillBackground{Color: color.RGBA{255, 255, 255, 255}}
+
+	case "green":
+		return painter.FillBackground{Color: color.RGBA{0, 128, 0, 255}}
+
+	case "update":
+		return painter.UpdateOp
+
+	case "bgrect":
+		if !arity(4) {
+			return nil
+		}
+		var c [4]float64
+		valid := true
+		for i := range c {
+			v, ok := x.float(line, cmd, args[i])
+			c[i], valid = v, valid && ok
+		}
+		if !valid {
+			return nil
+		}
+		w, h := float64(x.size.X), float64(x.size.Y)
+		r := image.Rect(int(c[0]*w), int(c[1]*h), int(c[2]*w), int(c[3]*h))
+		return painter.BgRect{Rect: r}
+
+	case "figure":
+		pos, named, ok := x.splitArgs(line, cmd, args, "size", "color", "rotate", "outline", "opacity", "blend")
+		if args = pos; !ok || !arity(2) {
+			return nil
+		}
+		px, okX := x.int(line, cmd, args[0])
+		py, okY := x.int(line, cmd, args[1])
+		fig := painter.DrawT180{
+			PosX:  px,
+			PosY:  py,
+			Size:  100,
+			Color: color.RGBA{255, 255, 0, 255},
+		}
+		valid := okX && okY
+		if f, ok := named["size"]; ok {
+			fig.Size, ok = x.int(line, cmd, f)
+			if limit := painter.MaxFigureSize(x.size); ok && fig.Size <= 0 {
+				x.errs.addf(line, cmd, f, "size must be positive, got %d", fig.Size)
+				ok = false
+			} else if ok && fig.Size > limit {
+				x.errs.addf(line, cmd, f, "size must be at most %d, got %d", limit, fig.Size)
+				ok = false
+			}
+			valid = valid && ok
+		}
+		if f, ok := named["color"]; ok {
+			fig.Color, ok = x.color(line, cmd, f)
+			valid = valid && ok
+		}
+		if f, ok := named["rotate"]; ok {
+			fig.Rotate, ok = x.float(line, cmd, f)
+			valid = valid && ok
+		}
+		if f, ok := named["outline"]; ok {
+			fig.Outline, fig.OutlineWidth, ok = x.outline(line, cmd, f)
+			valid = valid && ok
+		}
+		fig.Opacity, fig.Blend, ok = x.composite(line, cmd, named)
+		valid = valid && ok
+		if !valid {
+			return nil
+		}
+		return fig
+
+	case "move":
+		if !arity(2) {
+			return nil
+		}
+		px, okX := x.int(line, cmd, args[0])
+		py, okY := x.int(line, cmd, args[1])
+		if !okX || !okY {
+			return nil
+		}
+		return painter.Move{NewPos: image.Point{X: px, Y: py}}
+
+	case "border":
+		c := color.RGBA{0, 0, 0, 255}
+		if len(args) >= 1 {
+			var ok bool
+			if c, ok = x.color(line, cmd, args[0]); !ok {
+				return nil
+			}
+		}
+		return painter.Border{Thickness: 10, Color: c}
+
+	case "reset":
+		return painter.Reset{}
+
+	case "circle", "ellipse", "line", "polyline", "polygon":
+		return x.shape(line, cmd, fields)
+
+	case "text":
+		return x.text(line, cmd, fields)
+
+	case "sprite":
+		return x.sprite(line, cmd, fields)
+
+	case "moveshape":
+		return x.moveShape(line, cmd, fields)
+	}
+	x.errs.addf(line, "", fields[0], "unknown command: %s", cmd)
+	return nil
 }
@@ -1,6 +1,9 @@
 package lang_test
 
 import (
+	"errors"
+	"image"
+	"image/color"
 	"reflect"
 	"strings"
 	"testing"
@@ -136,3 +139,409 @@ func TestParser_Parse(t *testing.T) {
 		})
 	}
 }
+
+func TestParser_Scripting(t *testing.T) {
+	p := lang.Parser{}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []painter.Operation
+		wantErr string
+	}{
+		{
+			name:  "variables and expressions",
+			input: "let x = 400\nlet y = x / 2\nfigure x+50 y*2\nmove (x-100)*2 -y\n",
+			want: []painter.Operation{
+				painter.DrawT180{PosX: 450, PosY: 400, Size: 100, Color: color.RGBA{255, 255, 0, 255}},
+				painter.Move{NewPos: image.Pt(600, -200)},
+			},
+		},
+		{
+			name:  "repeat with implicit index",
+			input: "repeat 3 {\n  move i*10 i%2\n}\n",
+			want: []painter.Operation{
+				painter.Move{NewPos: image.Pt(0, 0)},
+				painter.Move{NewPos: image.Pt(10, 1)},
+				painter.Move{NewPos: image.Pt(20, 0)},
+			},
+		},
+		{
+			name:  "for with step and nested repeat",
+			input: "for x in 0..6 step 3 {\n  repeat 2 as k {\n    move x k\n  }\n}\n",
+			want: []painter.Operation{
+				painter.Move{NewPos: image.Pt(0, 0)},
+				painter.Move{NewPos: image.Pt(0, 1)},
+				painter.Move{NewPos: image.Pt(3, 0)},
+				painter.Move{NewPos: image.Pt(3, 1)},
+			},
+		},
+		{
+			name:  "negative step",
+			input: "for i in 2..0 step -1 {\nmove i i\n}\n",
+			want: []painter.Operation{
+				painter.Move{NewPos: image.Pt(2, 2)},
+				painter.Move{NewPos: image.Pt(1, 1)},
+			},
+		},
+		{
+			name:  "bgrect with expressions",
+			input: "let m = 0.25\nbgrect m m 1-m 1-m\n",
+			want: []painter.Operation{
+				painter.BgRect{Rect: image.Rect(200, 200, 600, 600)},
+			},
+		},
+		{
+			name:  "figure style",
+			input: "let s = 150\nfigure 400 400 size=s color=#f00 rotate=90 outline=black:3\nfigure 1 2 outline=blue\n",
+			want: []painter.Operation{
+				painter.DrawT180{
+					PosX: 400, PosY: 400, Size: 150, Color: color.RGBA{255, 0, 0, 255},
+					Rotate: 90, Outline: color.RGBA{0, 0, 0, 255}, OutlineWidth: 3,
+				},
+				painter.DrawT180{
+					PosX: 1, PosY: 2, Size: 100, Color: color.RGBA{255, 255, 0, 255},
+					Outline: color.RGBA{0, 0, 255, 255}, OutlineWidth: 1,
+				},
+			},
+		},
+		{
+			name:    "unknown figure argument",
+			input:   "figure 1 2 angle=3\n",
+			wantErr: `line 1, column 12: figure: unknown argument "angle", want one of size, color, rotate, outline`,
+		},
+		{
+			name:    "bad outline width",
+			input:   "figure 1 2 outline=red:0\n",
+			wantErr: "line 1, column 24: figure: outline width must be positive, got 0",
+		},
+		{
+			name:    "unknown border color",
+			input:   "border purple\n",
+			wantErr: `line 1, column 8: border: unknown color "purple"`,
+		},
+		{
+			name:  "border color",
+			input: "border #00f\n",
+			want:  []painter.Operation{painter.Border{Thickness: 10, Color: color.RGBA{0, 0, 255, 255}}},
+		},
+		{
+			name:    "figure too large",
+			input:   "figure 400 400 size=200000000\n",
+			wantErr: "line 1, column 21: figure: size must be at most 3200, got 200000000",
+		},
+		{
+			name:    "outline too wide",
+			input:   "figure 1 2 outline=red:5000\n",
+			wantErr: "line 1, column 24: figure: outline width must be at most 3200, got 5000",
+		},
+		{
+			name:    "positional after named",
+			input:   "figure 1 size=3 2\n",
+			wantErr: "line 1, column 17: figure: positional argument after named ones",
+		},
+		{
+			name:    "undefined variable",
+			input:   "white\nfigure x 10\n",
+			wantErr: "line 2, column 8: figure: undefined variable: x",
+		},
+		{
+			name:    "loop variable is scoped to the loop",
+			input:   "repeat 1 {\nupdate\n}\nmove i 0\n",
+			wantErr: "line 4, column 6: move: undefined variable: i",
+		},
+		{
+			name:    "missing closing brace",
+			input:   "repeat 2 {\nupdate\n",
+			wantErr: "missing }",
+		},
+		{
+			name:    "unexpected closing brace",
+			input:   "update\n}\n",
+			wantErr: "line 2, column 1: unexpected }",
+		},
+		{
+			name:    "zero step",
+			input:   "for i in 0..10 step 0 {\n}\n",
+			wantErr: "loop step must not be zero",
+		},
+		{
+			name:    "division by zero",
+			input:   "move 1/0 0\n",
+			wantErr: "division by zero",
+		},
+		{
+			name:    "too many iterations",
+			input:   "repeat 1000000 {\n}\n",
+			wantErr: "too many loop iterations",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := p.Parse(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(ops, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", ops, tt.want)
+			}
+		})
+	}
+}
+
+func TestParser_Errors(t *testing.T) {
+	p := lang.Parser{}
+
+	script := "white\n" +
+		"figure 100 abc\n" +
+		"  foobar 1\n" +
+		"let y = 2 +\n" +
+		"repeat 2 {\n" +
+		"  move q 1/0\n" +
+		"}\n" +
+		"bgrect 0.1 0.2\n"
+
+	_, err := p.Parse(strings.NewReader(script))
+	var errs lang.ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse() error = %v, want lang.ErrorList", err)
+	}
+
+	want := lang.ErrorList{
+		{Line: 2, Column: 12, Command: "figure", Token: "abc", Message: "undefined variable: abc"},
+		{Line: 3, Column: 3, Token: "foobar", Message: "unknown command: foobar"},
+		{Line: 4, Column: 12, Command: "let", Message: "unexpected end of expression"},
+		{Line: 6, Column: 8, Command: "move", Token: "q", Message: "undefined variable: q"},
+		{Line: 6, Column: 11, Command: "move", Token: "/", Message: "division by zero"},
+		{Line: 8, Column: 1, Command: "bgrect", Token: "bgrect", Message: "bgrect requires 4 arguments, got 2"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Parse() returned %d errors, want %d:\n%v", len(errs), len(want), errs)
+	}
+	for i := range want {
+		if *errs[i] != *want[i] {
+			t.Errorf("error %d = %+v, want %+v", i, *errs[i], *want[i])
+		}
+	}
+}
+
+func TestParser_Shapes(t *testing.T) {
+	p := lang.Parser{}
+	black := color.RGBA{0, 0, 0, 255}
+	yellow := color.RGBA{255, 255, 0, 255}
+	red := color.RGBA{255, 0, 0, 255}
+
+	tests := []struct {
+		input string
+		want  painter.Operation
+	}{
+		{
+			input: "circle 100 200 50",
+			want:  painter.DrawShape{Shape: painter.Shape{Kind: painter.Circle, Points: []image.Point{{100, 200}}, RX: 50, RY: 50, Fill: yellow}},
+		},
+		{
+			input: "ellipse 100 200 50 30 fill=red stroke=black width=3 id=sun",
+			want: painter.DrawShape{Shape: painter.Shape{
+				ID: "sun", Kind: painter.Ellipse, Points: []image.Point{{100, 200}}, RX: 50, RY: 30,
+				Fill: red, Stroke: black, StrokeWidth: 3,
+			}},
+		},
+		{
+			input: "polygon 0 0 10 0 10 10 stroke=red",
+			want: painter.DrawShape{Shape: painter.Shape{
+				Kind: painter.Polygon, Points: []image.Point{{0, 0}, {10, 0}, {10, 10}}, Stroke: red, StrokeWidth: 1,
+			}},
+		},
+		{
+			input: "line 0 0 100 100",
+			want:  painter.DrawShape{Shape: painter.Shape{Kind: painter.Line, Points: []image.Point{{0, 0}, {100, 100}}, Stroke: black, StrokeWidth: 1}},
+		},
+		{
+			input: "polyline 0 0 10 0 10 10 width=2",
+			want: painter.DrawShape{Shape: painter.Shape{
+				Kind: painter.Polyline, Points: []image.Point{{0, 0}, {10, 0}, {10, 10}}, Stroke: black, StrokeWidth: 2,
+			}},
+		},
+		{
+			input: "moveshape sun -10 5",
+			want:  painter.MoveShape{ID: "sun", By: image.Pt(-10, 5)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			ops, err := p.Parse(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ops) != 1 || !reflect.DeepEqual(ops[0], tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", ops, tt.want)
+			}
+		})
+	}
+
+	for _, input := range []string{
+		"circle 100 200",
+		"circle 100 200 0",
+		"ellipse 1 2 3",
+		"line 0 0 1 1 fill=red",
+		"polyline 0 0 1",
+		"polygon 0 0 1 1",
+		"circle 1 2 3 width=0",
+		"circle 1 2 3 id=9lives",
+		"moveshape sun 1",
+		"line 0 0 1 1 width=100000",
+		"polygon 0 0 10 0 10 -100000",
+	} {
+		t.Run(input, func(t *testing.T) {
+			if _, err := p.Parse(strings.NewReader(input)); err == nil {
+				t.Errorf("Parse(%q) succeeded, want an error", input)
+			}
+		})
+	}
+
+	// Shapes much larger than the canvas would take seconds to render.
+	_, err := p.Parse(strings.NewReader("circle 400 400 2000000000\nellipse 4000 0 10 10\n"))
+	var errs lang.ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse() error = %v, want lang.ErrorList", err)
+	}
+	wantErrs := lang.ErrorList{
+		{Line: 1, Column: 16, Command: "circle", Token: "2000000000", Message: "radius must be at most 3200, got 2000000000"},
+		{Line: 2, Column: 9, Command: "ellipse", Token: "4000", Message: "coordinate must be from -3200 to 3200, got 4000"},
+	}
+	if !reflect.DeepEqual(errs, wantErrs) {
+		t.Errorf("Parse() errors = %v, want %v", errs, wantErrs)
+	}
+}
+
+func TestParser_Text(t *testing.T) {
+	p := lang.Parser{}
+
+	ops, err := p.Parse(strings.NewReader(`text 10 20 "Hello, \"world\"\n= 2" size=26 color=red align=center id=title`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := painter.DrawShape{Shape: painter.Shape{
+		ID: "title", Kind: painter.Text, Points: []image.Point{{10, 20}},
+		Text: "Hello, \"world\"\n= 2", Size: 26, Align: painter.AlignCenter, Fill: color.RGBA{255, 0, 0, 255},
+	}}
+	if len(ops) != 1 || !reflect.DeepEqual(ops[0], want) {
+		t.Errorf("Parse() = %+v, want %+v", ops, want)
+	}
+
+	ops, err = p.Parse(strings.NewReader(`text 0 0 "a=b"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sh := ops[0].(painter.DrawShape).Shape; sh.Text != "a=b" || sh.Size != painter.DefaultTextSize || sh.Fill != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("text defaults = %+v", sh)
+	}
+
+	_, err = p.Parse(strings.NewReader("text 1 2 \"ok\"\ntext 1 2 hello\ntext 1 2 \"open\ntext 1 2 \"x\" align=top\ntext 1 2 \"x\" size=1000000\n"))
+	var errs lang.ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse() error = %v, want lang.ErrorList", err)
+	}
+	wantErrs := lang.ErrorList{
+		{Line: 2, Column: 10, Command: "text", Token: "hello", Message: "want a quoted string, got hello"},
+		{Line: 3, Column: 10, Command: "text", Token: `"open`, Message: `invalid string "open`},
+		{Line: 4, Column: 20, Command: "text", Token: "top", Message: `unknown alignment "top", want left, center or right`},
+		{Line: 5, Column: 19, Command: "text", Token: "1000000", Message: "size must be from 1 to the canvas height 800, got 1000000"},
+	}
+	if !reflect.DeepEqual(errs, wantErrs) {
+		t.Errorf("Parse() errors = %v, want %v", errs, wantErrs)
+	}
+}
+
+func TestParser_Sprite(t *testing.T) {
+	p := lang.Parser{}
+	ops, err := p.Parse(strings.NewReader("sprite logo.png 10 20\nsprite logo.png 10 20 30 40 id=logo\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []painter.Operation{
+		painter.DrawShape{Shape: painter.Shape{Kind: painter.Sprite, Asset: "logo.png", Points: []image.Point{{10, 20}}}},
+		painter.DrawShape{Shape: painter.Shape{ID: "logo", Kind: painter.Sprite, Asset: "logo.png", Points: []image.Point{{10, 20}}, W: 30, H: 40}},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("Parse() = %+v, want %+v", ops, want)
+	}
+
+	fromJSON, err := p.ParseJSON(strings.NewReader(`[{"op": "sprite", "name": "logo.png", "x": 10, "y": 20}, {"op": "sprite", "name": "logo.png", "x": 10, "y": 20, "w": 30, "h": 40, "id": "logo"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON, want) {
+		t.Errorf("ParseJSON() = %+v, want %+v", fromJSON, want)
+	}
+
+	for _, input := range []string{"sprite logo 1 2 3", "sprite logo 1 2 0 5", "sprite a/b 1 2"} {
+		if _, err := p.Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", input)
+		}
+	}
+	if _, err := p.ParseJSON(strings.NewReader(`[{"op": "sprite", "name": "logo", "x": 1, "y": 2, "w": 3}]`)); err == nil {
+		t.Error("ParseJSON() accepted a sprite with w and no h")
+	}
+
+	_, err = p.Parse(strings.NewReader("sprite logo 0 0 200000 200000\n"))
+	var errs lang.ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse() error = %v, want lang.ErrorList", err)
+	}
+	wantErrs := lang.ErrorList{
+		{Line: 1, Column: 17, Command: "sprite", Token: "200000", Message: "size must be positive and at most 3200x3200, got 200000x200000"},
+	}
+	if !reflect.DeepEqual(errs, wantErrs) {
+		t.Errorf("Parse() errors = %v, want %v", errs, wantErrs)
+	}
+}
+
+func TestParser_Opacity(t *testing.T) {
+	p := lang.Parser{}
+	ops, err := p.Parse(strings.NewReader("figure 10 10 color=#ff000080 opacity=0.5 blend=multiply\n" +
+		"circle 10 10 5 opacity=1/4 blend=screen\n" +
+		"text 10 10 \"hi\" opacity=0.5\n" +
+		"sprite logo 10 10 blend=normal\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fig := ops[0].(painter.DrawT180)
+	// Hex alpha is straight and colours are kept premultiplied.
+	if fig.Color != (color.RGBA{128, 0, 0, 128}) || fig.Opacity != 0.5 || fig.Blend != painter.BlendMultiply {
+		t.Errorf("figure = %+v", fig)
+	}
+	if sh := ops[1].(painter.DrawShape).Shape; sh.Opacity != 0.25 || sh.Blend != painter.BlendScreen {
+		t.Errorf("circle = %+v", sh)
+	}
+	if sh := ops[2].(painter.DrawShape).Shape; sh.Opacity != 0.5 {
+		t.Errorf("text = %+v", sh)
+	}
+	if sh := ops[3].(painter.DrawShape).Shape; sh.Blend != painter.BlendNormal || sh.Opacity != 0 {
+		t.Errorf("sprite = %+v", sh)
+	}
+
+	fromJSON, err := p.ParseJSON(strings.NewReader(`[{"op": "figure", "x": 10, "y": 10, "color": "#ff000080", "opacity": 0.5, "blend": "multiply"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromJSON[0], ops[0]) {
+		t.Errorf("ParseJSON() = %+v, want %+v", fromJSON[0], ops[0])
+	}
+
+	for _, input := range []string{"figure 1 1 opacity=0", "figure 1 1 opacity=1.5", "circle 1 1 1 blend=overlay", "line 0 0 1 1 opacity=-1"} {
+		if _, err := p.Parse(strings.NewReader(input)); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", input)
+		}
+	}
+	if _, err := p.ParseJSON(strings.NewReader(`[{"op": "polygon", "points": [{"x": 0, "y": 0}, {"x": 1, "y": 0}, {"x": 1, "y": 1}], "blend": 3}]`)); err == nil {
+		t.Error("ParseJSON() accepted a numeric blend mode")
+	}
+}
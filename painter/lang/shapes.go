@@ -0,0 +1,563 @@
+package lang
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"regexp"
+
+	"github.com/roman-mazur/architecture-lab-3/painter"
+)
+
+// shapeArgs are the named arguments of the shape commands.
+var shapeArgs = []string{"fill", "stroke", "width", "id", "opacity", "blend"}
+
+var validID = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// validAsset matches the names painter.Assets accepts.
+var validAsset = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// shapeStyle holds the style arguments shared by the shape commands.
+type shapeStyle struct {
+	fill, stroke       color.RGBA
+	hasFill, hasStroke bool
+	width              int
+	hasWidth           bool
+	id                 string
+}
+
+// apply styles sh. Closed shapes without a stroke are filled with yellow,
+// like figures; strokes are black and 1 pixel wide unless told otherwise,
+// and open shapes always have one.
+func (st shapeStyle) apply(sh *painter.Shape, closed bool) {
+	sh.ID = st.id
+	stroked := st.hasStroke || st.hasWidth || !closed
+	if closed {
+		switch {
+		case st.hasFill:
+			sh.Fill = st.fill
+		case !stroked:
+			sh.Fill = color.RGBA{255, 255, 0, 255}
+		}
+	}
+	if stroked {
+		sh.Stroke, sh.StrokeWidth = color.RGBA{0, 0, 0, 255}, 1
+		if st.hasStroke {
+			sh.Stroke = st.stroke
+		}
+		if st.hasWidth {
+			sh.StrokeWidth = st.width
+		}
+	}
+}
+
+// style reads the named shape arguments.
+func (x *executor) style(line int, cmd string, named map[string]field) (shapeStyle, bool) {
+	var st shapeStyle
+	ok := true
+	if f, has := named["fill"]; has {
+		if cmd == "line" || cmd == "polyline" {
+			x.errs.addf(line, cmd, f, "%s cannot be filled", cmd)
+			ok = false
+		} else {
+			st.hasFill = true
+			st.fill, has = x.color(line, cmd, f)
+			ok = ok && has
+		}
+	}
+	if f, has := named["stroke"]; has {
+		st.hasStroke = true
+		st.stroke, has = x.color(line, cmd, f)
+		ok = ok && has
+	}
+	if f, has := named["width"]; has {
+		st.hasWidth = true
+		st.width, has = x.int(line, cmd, f)
+		if has && st.width <= 0 {
+			x.errs.addf(line, cmd, f, "width must be positive, got %d", st.width)
+			has = false
+		} else if limit := painter.MaxExtent(x.size); has && st.width > limit {
+			x.errs.addf(line, cmd, f, "width must be at most %d, got %d", limit, st.width)
+			has = false
+		}
+		ok = ok && has
+	}
+	if f, has := named["id"]; has {
+		if st.id = f.text; !validID.MatchString(st.id) {
+			x.errs.addf(line, cmd, f, "invalid id %q", st.id)
+			ok = false
+		}
+	}
+	return st, ok
+}
+
+// points reads pairs of coordinates.
+func (x *executor) points(line int, cmd string, args []field) ([]image.Point, bool) {
+	pts := make([]image.Point, len(args)/2)
+	ok := true
+	for i := range pts {
+		px, okX := x.coord(line, cmd, args[2*i])
+		py, okY := x.coord(line, cmd, args[2*i+1])
+		pts[i], ok = image.Pt(px, py), ok && okX && okY
+	}
+	return pts, ok
+}
+
+// coord reads a coordinate of a shape, at most painter.MaxExtent away from
+// the origin.
+func (x *executor) coord(line int, cmd string, arg field) (int, bool) {
+	v, ok := x.int(line, cmd, arg)
+	if limit := painter.MaxExtent(x.size); ok && (v < -limit || v > limit) {
+		x.errs.addf(line, cmd, arg, "coordinate must be from %d to %d, got %d", -limit, limit, v)
+		ok = false
+	}
+	return v, ok
+}
+
+// radius reads a positive radius of at most painter.MaxExtent.
+func (x *executor) radius(line int, cmd string, arg field) (int, bool) {
+	r, ok := x.int(line, cmd, arg)
+	if ok && r <= 0 {
+		x.errs.addf(line, cmd, arg, "radius must be positive, got %d", r)
+		ok = false
+	} else if limit := painter.MaxExtent(x.size); ok && r > limit {
+		x.errs.addf(line, cmd, arg, "radius must be at most %d, got %d", limit, r)
+		ok = false
+	}
+	return r, ok
+}
+
+// shape builds the operation of the circle, ellipse, line, polyline and
+// polygon commands.
+func (x *executor) shape(line int, cmd string, fields []field) painter.Operation {
+	pos, named, ok := x.splitArgs(line, cmd, fields[1:], shapeArgs...)
+	if !ok {
+		return nil
+	}
+	st, ok := x.style(line, cmd, named)
+
+	sh := painter.Shape{Kind: painter.ShapeKind(cmd)}
+	var okC bool
+	sh.Opacity, sh.Blend, okC = x.composite(line, cmd, named)
+	ok = ok && okC
+	// want is the number of positional arguments, or the smallest number of
+	// them for polylines and polygons, which take any number of points.
+	want := map[string]int{"circle": 3, "ellipse": 4, "line": 4, "polyline": 4, "polygon": 6}[cmd]
+	exact := cmd != "polyline" && cmd != "polygon"
+	switch {
+	case exact && len(pos) != want:
+		x.errs.addf(line, cmd, fields[0], "%s requires %d arguments, got %d", cmd, want, len(pos))
+		return nil
+	case !exact && (len(pos) < want || len(pos)%2 != 0):
+		x.errs.addf(line, cmd, fields[0], "%s requires pairs of coordinates of at least %d points, got %d arguments", cmd, want/2, len(pos))
+		return nil
+	}
+
+	var okP, okR bool
+	switch cmd {
+	case "circle":
+		sh.Points, okP = x.points(line, cmd, pos[:2])
+		sh.RX, okR = x.radius(line, cmd, pos[2])
+		sh.RY = sh.RX
+	case "ellipse":
+		sh.Points, okP = x.points(line, cmd, pos[:2])
+		sh.RX, okR = x.radius(line, cmd, pos[2])
+		var okRY bool
+		sh.RY, okRY = x.radius(line, cmd, pos[3])
+		okR = okR && okRY
+	default:
+		sh.Points, okP = x.points(line, cmd, pos)
+		okR = true
+	}
+	if !ok || !okP || !okR {
+		return nil
+	}
+	st.apply(&sh, cmd != "line" && cmd != "polyline")
+	return painter.DrawShape{Shape: sh}
+}
+
+// textArgs are the named arguments of the text command.
+var textArgs = []string{"size", "color", "align", "id", "opacity", "blend"}
+
+// text builds the operation of `text x y "string"`.
+func (x *executor) text(line int, cmd string, fields []field) painter.Operation {
+	pos, named, ok := x.splitArgs(line, cmd, fields[1:], textArgs...)
+	if !ok {
+		return nil
+	}
+	if len(pos) != 3 {
+		x.errs.addf(line, cmd, fields[0], "%s requires 3 arguments, got %d", cmd, len(pos))
+		return nil
+	}
+	pts, ok := x.points(line, cmd, pos[:2])
+	s, okS := x.string(line, cmd, pos[2])
+	sh := painter.Shape{Kind: painter.Text, Points: pts, Text: s, Size: painter.DefaultTextSize, Fill: color.RGBA{0, 0, 0, 255}}
+	ok = ok && okS
+	if okS && s == "" {
+		x.errs.addf(line, cmd, pos[2], "text must not be empty")
+		ok = false
+	}
+	if f, has := named["size"]; has {
+		sh.Size, has = x.int(line, cmd, f)
+		if has && (sh.Size <= 0 || sh.Size > x.size.Y) {
+			x.errs.addf(line, cmd, f, "size must be from 1 to the canvas height %d, got %d", x.size.Y, sh.Size)
+			has = false
+		}
+		ok = ok && has
+	}
+	if f, has := named["color"]; has {
+		sh.Fill, has = x.color(line, cmd, f)
+		ok = ok && has
+	}
+	if f, has := named["align"]; has {
+		if sh.Align = painter.Align(f.text); !validAlign(sh.Align) {
+			x.errs.addf(line, cmd, f, "unknown alignment %q, want left, center or right", f.text)
+			ok = false
+		}
+	}
+	var okC bool
+	sh.Opacity, sh.Blend, okC = x.composite(line, cmd, named)
+	ok = ok && okC
+	if f, has := named["id"]; has {
+		if sh.ID = f.text; !validID.MatchString(sh.ID) {
+			x.errs.addf(line, cmd, f, "invalid id %q", sh.ID)
+			ok = false
+		}
+	}
+	if !ok {
+		return nil
+	}
+	return painter.DrawShape{Shape: sh}
+}
+
+func validAlign(a painter.Align) bool {
+	return a == painter.AlignLeft || a == painter.AlignCenter || a == painter.AlignRight
+}
+
+// checkSpriteSize bounds sprite sizes to painter.MaxScale times the canvas
+// size.
+func checkSpriteSize(w, h int, canvas image.Point) error {
+	limit := canvas.Mul(painter.MaxScale)
+	if w <= 0 || h <= 0 || w > limit.X || h > limit.Y {
+		return fmt.Errorf("size must be positive and at most %dx%d, got %dx%d", limit.X, limit.Y, w, h)
+	}
+	return nil
+}
+
+// sprite builds the operation of "sprite name x y [w h]". The image is
+// looked up when the sprite is drawn, so it may be uploaded later.
+func (x *executor) sprite(line int, cmd string, fields []field) painter.Operation {
+	pos, named, ok := x.splitArgs(line, cmd, fields[1:], "id", "opacity", "blend")
+	if !ok {
+		return nil
+	}
+	if len(pos) != 3 && len(pos) != 5 {
+		x.errs.addf(line, cmd, fields[0], "%s requires 3 or 5 arguments, got %d", cmd, len(pos))
+		return nil
+	}
+	sh := painter.Shape{Kind: painter.Sprite, Asset: pos[0].text}
+	if !validAsset.MatchString(sh.Asset) {
+		x.errs.addf(line, cmd, pos[0], "invalid asset name %q", sh.Asset)
+		ok = false
+	}
+	var okP bool
+	sh.Points, okP = x.points(line, cmd, pos[1:3])
+	ok = ok && okP
+	if len(pos) == 5 {
+		var okW, okH bool
+		sh.W, okW = x.int(line, cmd, pos[3])
+		sh.H, okH = x.int(line, cmd, pos[4])
+		if okW && okH {
+			if err := checkSpriteSize(sh.W, sh.H, x.size); err != nil {
+				x.errs.addErr(line, cmd, pos[3], err)
+				okW = false
+			}
+		}
+		ok = ok && okW && okH
+	}
+	var okC bool
+	sh.Opacity, sh.Blend, okC = x.composite(line, cmd, named)
+	ok = ok && okC
+	if f, has := named["id"]; has {
+		if sh.ID = f.text; !validID.MatchString(sh.ID) {
+			x.errs.addf(line, cmd, f, "invalid id %q", sh.ID)
+			ok = false
+		}
+	}
+	if !ok {
+		return nil
+	}
+	return painter.DrawShape{Shape: sh}
+}
+
+// moveShape builds the operation of "moveshape id dx dy".
+func (x *executor) moveShape(line int, cmd string, fields []field) painter.Operation {
+	args := fields[1:]
+	if len(args) != 3 {
+		x.errs.addf(line, cmd, fields[0], "%s requires 3 arguments, got %d", cmd, len(args))
+		return nil
+	}
+	id := args[0].text
+	ok := validID.MatchString(id)
+	if !ok {
+		x.errs.addf(line, cmd, args[0], "invalid id %q", id)
+	}
+	dx, okX := x.int(line, cmd, args[1])
+	dy, okY := x.int(line, cmd, args[2])
+	if !ok || !okX || !okY {
+		return nil
+	}
+	return painter.MoveShape{ID: id, By: image.Pt(dx, dy)}
+}
+
+// shape builds the operation of the JSON shape commands.
+func (jc *jsonCommand) shape() painter.Operation {
+	st, ok := jc.style()
+	sh := painter.Shape{Kind: painter.ShapeKind(jc.op)}
+	var okC bool
+	sh.Opacity, sh.Blend, okC = jc.composite()
+	ok = ok && okC
+	switch jc.op {
+	case "circle", "ellipse":
+		x, okX := jc.coord("x")
+		y, okY := jc.coord("y")
+		sh.Points = []image.Point{image.Pt(int(math.Round(x)), int(math.Round(y)))}
+		ok = ok && okX && okY
+		var okR, okRY bool
+		if jc.op == "circle" {
+			sh.RX, okR = jc.radius("r")
+			sh.RY, okRY = sh.RX, true
+		} else {
+			sh.RX, okR = jc.radius("rx")
+			sh.RY, okRY = jc.radius("ry")
+		}
+		ok = ok && okR && okRY
+	case "line":
+		var c [4]float64
+		for i, name := range []string{"x1", "y1", "x2", "y2"} {
+			var okC bool
+			c[i], okC = jc.coord(name)
+			ok = ok && okC
+		}
+		sh.Points = []image.Point{
+			image.Pt(int(math.Round(c[0])), int(math.Round(c[1]))),
+			image.Pt(int(math.Round(c[2])), int(math.Round(c[3]))),
+		}
+	default:
+		var okP bool
+		sh.Points, okP = jc.points("points", map[string]int{"polyline": 2, "polygon": 3}[jc.op])
+		ok = ok && okP
+	}
+	if !ok {
+		return nil
+	}
+	st.apply(&sh, sh.Kind != painter.Line && sh.Kind != painter.Polyline)
+	return painter.DrawShape{Shape: sh}
+}
+
+// style reads the style fields of a JSON shape command.
+func (jc *jsonCommand) style() (shapeStyle, bool) {
+	var st shapeStyle
+	ok := true
+	if _, st.hasFill = jc.fields["fill"]; st.hasFill {
+		var okF bool
+		st.fill, okF = jc.color("fill", color.RGBA{})
+		ok = ok && okF
+	}
+	if _, st.hasStroke = jc.fields["stroke"]; st.hasStroke {
+		var okS bool
+		st.stroke, okS = jc.color("stroke", color.RGBA{})
+		ok = ok && okS
+	}
+	if _, st.hasWidth = jc.fields["width"]; st.hasWidth {
+		w, okW := jc.number("width")
+		if st.width = int(math.Round(w)); okW && st.width <= 0 {
+			jc.errorf("width", "width must be positive, got %v", w)
+			okW = false
+		} else if limit := painter.MaxExtent(jc.size); okW && st.width > limit {
+			jc.errorf("width", "width must be at most %d, got %v", limit, w)
+			okW = false
+		}
+		ok = ok && okW
+	}
+	if _, has := jc.fields["id"]; has {
+		var okID bool
+		st.id, okID = jc.id()
+		ok = ok && okID
+	}
+	return st, ok
+}
+
+func (jc *jsonCommand) id() (string, bool) {
+	id, ok := jc.fields["id"].(string)
+	switch {
+	case !ok:
+		jc.errorf("id", "field \"id\" must be a string")
+	case !validID.MatchString(id):
+		jc.errorf("id", "invalid id %q", id)
+		ok = false
+	}
+	return id, ok
+}
+
+func (jc *jsonCommand) radius(name string) (int, bool) {
+	v, ok := jc.number(name)
+	r := int(math.Round(v))
+	if ok && r <= 0 {
+		jc.errorf(name, "radius must be positive, got %v", v)
+		ok = false
+	} else if limit := painter.MaxExtent(jc.size); ok && r > limit {
+		jc.errorf(name, "radius must be at most %d, got %v", limit, v)
+		ok = false
+	}
+	return r, ok
+}
+
+// coord reads a coordinate of a shape, at most painter.MaxExtent away from
+// the origin.
+func (jc *jsonCommand) coord(name string) (float64, bool) {
+	v, ok := jc.number(name)
+	if limit := float64(painter.MaxExtent(jc.size)); ok && math.Abs(math.Round(v)) > limit {
+		jc.errorf(name, "coordinate must be from %v to %v, got %v", -limit, limit, v)
+		ok = false
+	}
+	return v, ok
+}
+
+// points reads an array of at least the given number of {"x": ..., "y": ...} objects.
+func (jc *jsonCommand) points(name string, least int) ([]image.Point, bool) {
+	arr, ok := jc.fields[name].([]any)
+	if !ok {
+		jc.errorf(name, "field %q must be an array of points", name)
+		return nil, false
+	}
+	if len(arr) < least {
+		jc.errorf(name, "%s requires at least %d points, got %d", jc.op, least, len(arr))
+		return nil, false
+	}
+	pts := make([]image.Point, len(arr))
+	for i, v := range arr {
+		obj, isObj := v.(map[string]any)
+		x, okX := obj["x"].(float64)
+		y, okY := obj["y"].(float64)
+		if !isObj || len(obj) != 2 || !okX || !okY {
+			jc.errorf(name, "point %d must be an object with numbers x and y", i+1)
+			return nil, false
+		}
+		pts[i] = image.Pt(int(math.Round(x)), int(math.Round(y)))
+		if limit := float64(painter.MaxExtent(jc.size)); math.Abs(math.Round(x)) > limit || math.Abs(math.Round(y)) > limit {
+			jc.errorf(name, "point %d must be from %v to %v in both coordinates", i+1, -limit, limit)
+			return nil, false
+		}
+	}
+	return pts, true
+}
+
+// text builds the operation of the JSON text command.
+func (jc *jsonCommand) text() painter.Operation {
+	x, okX := jc.coord("x")
+	y, okY := jc.coord("y")
+	c, okC := jc.color("color", color.RGBA{0, 0, 0, 255})
+	s, okS := jc.fields["text"].(string)
+	switch {
+	case !okS:
+		jc.errorf("text", "field \"text\" must be a string")
+	case s == "":
+		jc.errorf("text", "text must not be empty")
+		okS = false
+	}
+	sh := painter.Shape{
+		Kind:   painter.Text,
+		Points: []image.Point{image.Pt(int(math.Round(x)), int(math.Round(y)))},
+		Text:   s,
+		Size:   painter.DefaultTextSize,
+		Fill:   c,
+	}
+	ok := okX && okY && okC && okS
+	var okComp bool
+	sh.Opacity, sh.Blend, okComp = jc.composite()
+	ok = ok && okComp
+	if _, has := jc.fields["size"]; has {
+		size, okSize := jc.number("size")
+		if sh.Size = int(math.Round(size)); okSize && (sh.Size <= 0 || sh.Size > jc.size.Y) {
+			jc.errorf("size", "size must be from 1 to the canvas height %d, got %v", jc.size.Y, size)
+			okSize = false
+		}
+		ok = ok && okSize
+	}
+	if v, has := jc.fields["align"]; has {
+		a, _ := v.(string)
+		if sh.Align = painter.Align(a); !validAlign(sh.Align) {
+			jc.errorf("align", "field \"align\" must be left, center or right")
+			ok = false
+		}
+	}
+	if _, has := jc.fields["id"]; has {
+		var okID bool
+		sh.ID, okID = jc.id()
+		ok = ok && okID
+	}
+	if !ok {
+		return nil
+	}
+	return painter.DrawShape{Shape: sh}
+}
+
+// sprite builds the operation of the JSON sprite command.
+func (jc *jsonCommand) sprite() painter.Operation {
+	name, ok := jc.fields["name"].(string)
+	if !ok || !validAsset.MatchString(name) {
+		jc.errorf("name", "field \"name\" must be an asset name")
+		ok = false
+	}
+	x, okX := jc.coord("x")
+	y, okY := jc.coord("y")
+	sh := painter.Shape{
+		Kind:   painter.Sprite,
+		Asset:  name,
+		Points: []image.Point{image.Pt(int(math.Round(x)), int(math.Round(y)))},
+	}
+	ok = ok && okX && okY
+	_, hasW := jc.fields["w"]
+	_, hasH := jc.fields["h"]
+	switch {
+	case hasW != hasH:
+		jc.errorf("w", "fields \"w\" and \"h\" go together")
+		ok = false
+	case hasW:
+		w, okW := jc.number("w")
+		h, okH := jc.number("h")
+		sh.W, sh.H = int(math.Round(w)), int(math.Round(h))
+		if okW && okH {
+			if err := checkSpriteSize(sh.W, sh.H, jc.size); err != nil {
+				jc.errorf("w", "%s", err)
+				okW = false
+			}
+		}
+		ok = ok && okW && okH
+	}
+	var okC bool
+	sh.Opacity, sh.Blend, okC = jc.composite()
+	ok = ok && okC
+	if _, has := jc.fields["id"]; has {
+		var okID bool
+		sh.ID, okID = jc.id()
+		ok = ok && okID
+	}
+	if !ok {
+		return nil
+	}
+	return painter.DrawShape{Shape: sh}
+}
+
+// moveShape builds the operation of the JSON moveshape command.
+func (jc *jsonCommand) moveShape() painter.Operation {
+	id, ok := jc.id()
+	dx, okX := jc.number("dx")
+	dy, okY := jc.number("dy")
+	if !ok || !okX || !okY {
+		return nil
+	}
+	return painter.MoveShape{ID: id, By: image.Pt(int(math.Round(dx)), int(math.Round(dy)))}
+}
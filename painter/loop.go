@@ -1,30 +1,59 @@
 package painter
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"log"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"golang.org/x/exp/shiny/imageutil"
 	"golang.org/x/exp/shiny/screen"
 )
 
+// Receiver shows the frames of a Loop. It owns the texture t until it calls
+// release, which it must do once t is no longer shown, e.g. after the next
+// Update. The Loop does not draw into t before that. release may be called
+// more than once and from any goroutine.
 type Receiver interface {
-	Update(t screen.Texture)
+	Update(t screen.Texture, release func())
 }
 
+// poolSize is the number of textures of a Loop: one shown by the Receiver,
+// one being drawn and a spare for a frame in flight.
+const poolSize = 3
+
 type Loop struct {
 	Receiver Receiver
-
+	// Size is the canvas size, DefaultSize if not set.
+	Size image.Point
+	// Initial is the scene shown before the first command. Reset goes back
+	// to its background. If nil, a yellow figure on green is shown.
+	Initial *Scene
+	// Assets are the images of sprites.
+	Assets *Assets
+
+	// next is the texture being drawn. It is owned by the Loop goroutine;
+	// free holds the textures not leased to the Receiver.
 	next screen.Texture
-	prev screen.Texture
+	free chan screen.Texture
+	// buf is where frames are rendered before they are uploaded to next.
+	buf screen.Buffer
+	// texMu guards closed, which is set once the textures are released.
+	// Textures the Receiver gives back after that are released right away.
+	texMu  sync.Mutex
+	closed bool
 
 	mq messageQueue
 
-	stopReq bool
-	stopped chan struct{}
+	stopReq atomic.Bool
+	// stopping is closed by StopAndWait, so that the Loop goroutine does
+	// not wait for textures the Receiver may never give back.
+	stopping chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
 
 	mu sync.Mutex
 
@@ -32,29 +61,94 @@ type Loop struct {
 	bgRect  *image.Rectangle
 	border  *Border
 	figures []DrawT180
+	shapes  []Shape
+	// shapeSeq numbers the IDs given to shapes drawn without one.
+	shapeSeq int
+
+	// presented is the scene of the last update and frameSeq counts updates.
+	presented Scene
+	frameSeq  uint64
+	// pending are the scenes of the updates in the current operation. They
+	// are drawn and sent to the Receiver once mu is released.
+	pending []Scene
+	// lastOp is the last operation taken from the queue.
+	lastOp Operation
+
+	events events
 }
 
-var size = image.Pt(800, 800)
+// DefaultSize is the canvas size of a Loop without a Size.
+var DefaultSize = image.Pt(800, 800)
+
+// DefaultScene returns the scene shown by a Loop without an Initial scene:
+// a 200px yellow figure in the centre of a green canvas of the given size.
+func DefaultScene(size image.Point) Scene {
+	return Scene{
+		Background: color.RGBA{0, 128, 0, 255},
+		Figures: []DrawT180{{
+			PosX:  size.X / 2,
+			PosY:  size.Y / 2,
+			Size:  200,
+			Color: color.RGBA{255, 255, 0, 255},
+		}},
+	}
+}
 
+// Start creates the textures on s and starts handling posted operations. A
+// nil screen keeps the textures in memory, so the Loop runs headless.
 func (l *Loop) Start(s screen.Screen) {
-	l.next, _ = s.NewTexture(size)
-	l.prev, _ = s.NewTexture(size)
-
-	l.bgColor = color.RGBA{0, 128, 0, 255}
+	l.mu.Lock()
+	if l.Size == (image.Point{}) {
+		l.Size = DefaultSize
+	}
+	if l.Initial == nil {
+		initial := DefaultScene(l.Size)
+		l.Initial = &initial
+	}
+	l.mu.Unlock()
+
+	l.free = make(chan screen.Texture, poolSize)
+	for range poolSize {
+		if s == nil {
+			l.free <- newMemTexture(l.Size)
+		} else {
+			t, _ := s.NewTexture(l.Size)
+			l.free <- t
+		}
+	}
+	l.next = <-l.free
+	if s == nil {
+		l.buf = newMemBuffer(l.Size)
+	} else {
+		l.buf, _ = s.NewBuffer(l.Size)
+	}
 
-	l.figures = append(l.figures, DrawT180{
-		PosX:  size.X / 2,
-		PosY:  size.Y / 2,
-		Size:  200,
-		Color: color.RGBA{255, 255, 0, 255},
-	})
+	initial := l.Initial.clone()
+	l.bgColor, l.bgRect, l.border = initial.Background, initial.BgRect, initial.Border
+	l.figures = append(l.figures, initial.Figures...)
+	l.shapes = append(l.shapes, initial.Shapes...)
 
+	l.stopping = make(chan struct{})
 	l.stopped = make(chan struct{})
+	// Operations posted before Start, such as an initial script, are
+	// handled before the initial scene is presented, so that it does not
+	// flash in the window before their first frame.
+	early := l.mq.len()
 
 	go func() {
 		defer close(l.stopped)
+		for range early {
+			op := l.mq.pull()
+			l.handleOp(op)
+			l.events.publish(op, l.FrameSeq())
+		}
+		// Present the initial scene unless they did, so that the Receiver
+		// never shows anything but frames of the Loop.
+		if l.FrameSeq() == 0 {
+			l.handleOp(UpdateOp)
+		}
 		for {
-			if l.stopReq && l.mq.empty() {
+			if l.stopReq.Load() && l.mq.empty() {
 				return
 			}
 
@@ -65,20 +159,92 @@ func (l *Loop) Start(s screen.Screen) {
 			}
 
 			l.handleOp(op)
+			l.events.publish(op, l.FrameSeq())
 		}
 	}()
 }
 
+// handleOp applies op and presents the frames of its updates. The frames
+// are drawn and the Receiver is called without holding mu, so that the
+// Receiver may query the Loop.
 func (l *Loop) handleOp(op Operation) {
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.lastOp = op
+	l.handleOpLocked(op)
+	r, frames := l.Receiver, l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	for _, s := range frames {
+		l.present(r, s)
+	}
+}
+
+// present renders s and uploads it to the next texture, which is leased
+// to r. The next frame is drawn into a texture released by r, so this waits
+// while r holds all the others. Once the Loop is stopping, it stops waiting
+// and the frames left are not presented.
+func (l *Loop) present(r Receiver, s Scene) {
+	t := l.next
+	if t == nil {
+		return
+	}
+	s.render(l.buf.RGBA())
+	t.Upload(image.Point{}, l.buf, l.buf.Bounds())
+	if r == nil {
+		return
+	}
+	var once sync.Once
+	r.Update(t, func() {
+		once.Do(func() { l.giveBack(t) })
+	})
+	select {
+	case l.next = <-l.free:
+		return
+	default:
+	}
+	select {
+	case l.next = <-l.free:
+	case <-l.stopping:
+		l.next = nil
+	}
+}
 
+// giveBack returns a texture released by the Receiver to the pool, or
+// releases it if the Loop has stopped.
+func (l *Loop) giveBack(t screen.Texture) {
+	l.texMu.Lock()
+	defer l.texMu.Unlock()
+	if l.closed {
+		t.Release()
+		return
+	}
+	l.free <- t
+}
+
+// releaseTextures releases the buffer and the textures not leased to the
+// Receiver once the Loop goroutine has stopped.
+func (l *Loop) releaseTextures() {
+	l.texMu.Lock()
+	defer l.texMu.Unlock()
+	l.closed = true
+	for len(l.free) > 0 {
+		(<-l.free).Release()
+	}
+	if l.next != nil {
+		l.next.Release()
+		l.next = nil
+	}
+	l.buf.Release()
+}
+
+func (l *Loop) handleOpLocked(op Operation) {
 	log.Printf("Handling operation: %T %+v", op, op)
 
 	switch op := op.(type) {
 	case OperationList:
 		for _, o := range op {
-			l.handleOp(o)
+			l.handleOpLocked(o)
 		}
 
 	case FillBackground:
@@ -89,56 +255,235 @@ func (l *Loop) handleOp(op Operation) {
 		l.bgRect = &op.Rect
 
 	case Reset:
-		l.bgColor = color.RGBA{0, 128, 0, 255}
+		l.bgColor = l.Initial.Background
 		l.bgRect = nil
 		l.figures = nil
+		l.shapes = nil
 		l.border = nil
 
 	case DrawT180:
 		l.figures = append(l.figures, op)
 
+	case AddFigure:
+		l.figures = append(l.figures, op.Figure)
+		if op.Added != nil {
+			op.Added(len(l.figures) - 1)
+		}
+
 	case Move:
 		for i := range l.figures {
 			l.figures[i].PosX = op.NewPos.X
 			l.figures[i].PosY = op.NewPos.Y
 		}
+		for i, sh := range l.shapes {
+			l.shapes[i] = sh.moved(op.NewPos.Sub(sh.Points[0]))
+		}
+
+	case DrawShape:
+		l.drawShapeLocked(op.Shape.clone())
+
+	case MoveShape:
+		if i := l.shapeLocked(op.ID); i >= 0 {
+			l.shapes[i] = l.shapes[i].moved(op.By)
+		}
+
+	case MoveFigure:
+		if f := l.figureLocked(op.Index); f != nil {
+			f.PosX += op.By.X
+			f.PosY += op.By.Y
+		}
+
+	case ResizeFigure:
+		if f := l.figureLocked(op.Index); f != nil {
+			f.Size = min(MaxFigureSize(l.sizeLocked()), max(MinFigureSize, f.Size+op.By))
+		}
 
 	case Border:
 		l.border = &op
 
+	case SetScene:
+		s := op.Scene.clone()
+		l.bgColor, l.bgRect, l.border, l.figures, l.shapes = s.Background, s.BgRect, s.Border, s.Figures, s.Shapes
+
 	case updateOp:
-		l.next.Fill(l.next.Bounds(), l.bgColor, screen.Src)
+		l.presented = l.sceneLocked()
+		l.frameSeq++
+		l.pending = append(l.pending, l.presented)
+
+	default:
+		if l.next != nil {
+			op.Do(l.next)
+		}
+	}
+}
+
+// figureLocked returns the figure at index i, counting from the end for
+// negative i, or nil.
+func (l *Loop) figureLocked(i int) *DrawT180 {
+	if i < 0 {
+		i += len(l.figures)
+	}
+	if i < 0 || i >= len(l.figures) {
+		return nil
+	}
+	return &l.figures[i]
+}
 
-		if l.bgRect != nil {
-			l.next.Fill(*l.bgRect, color.Black, screen.Src)
+// drawShapeLocked adds sh or replaces the shape with its ID. Sprites without
+// a size get the size of their image, if it is there.
+func (l *Loop) drawShapeLocked(sh Shape) {
+	if sh.Kind == Sprite && sh.W == 0 {
+		if img, ok := l.Assets.Get(sh.Asset); ok {
+			sh.W, sh.H = img.Rect.Dx(), img.Rect.Dy()
 		}
+	}
+	if sh.ID == "" {
+		for sh.ID == "" || l.shapeLocked(sh.ID) >= 0 {
+			l.shapeSeq++
+			sh.ID = fmt.Sprintf("%s-%d", sh.Kind, l.shapeSeq)
+		}
+	}
+	if i := l.shapeLocked(sh.ID); i >= 0 {
+		l.shapes[i] = sh
+		return
+	}
+	l.shapes = append(l.shapes, sh)
+}
+
+// shapeLocked returns the index of the shape with the given ID, or -1.
+func (l *Loop) shapeLocked(id string) int {
+	return slices.IndexFunc(l.shapes, func(sh Shape) bool { return sh.ID == id })
+}
 
-		for _, f := range l.figures {
-			drawT180(l.next, f.PosX, f.PosY, f.Size, f.Color)
+// ShapeAt returns the ID of the top-most shape on the pixel p.
+func (l *Loop) ShapeAt(p image.Point) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.shapes) - 1; i >= 0; i-- {
+		if l.shapes[i].Contains(p) {
+			return l.shapes[i].ID, true
 		}
+	}
+	return "", false
+}
 
-		if l.border != nil {
-			borders := imageutil.Border(l.next.Bounds(), l.border.Thickness)
-			for _, r := range borders {
-				l.next.Fill(r, l.border.Color, screen.Src)
-			}
+// FigureAt returns the index of the top figure whose bounds contain p. Only
+// the parts of figures on the canvas are hit.
+func (l *Loop) FigureAt(p image.Point) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	canvas := image.Rectangle{Max: l.sizeLocked()}
+	if !p.In(canvas) {
+		return 0, false
+	}
+	for i := len(l.figures) - 1; i >= 0; i-- {
+		if p.In(l.figures[i].Geometry().BoundsIn(canvas)) {
+			return i, true
 		}
+	}
+	return 0, false
+}
 
-		l.Receiver.Update(l.next)
-		l.next, l.prev = l.prev, l.next
+// SetReceiver changes the Receiver of a running Loop.
+func (l *Loop) SetReceiver(r Receiver) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Receiver = r
+}
 
-	default:
-		op.Do(l.next)
+func (l *Loop) sceneLocked() Scene {
+	return Scene{
+		Background: l.bgColor,
+		BgRect:     l.bgRect,
+		Border:     l.border,
+		Figures:    l.figures,
+		Shapes:     l.shapes,
+		Assets:     l.Assets,
+	}.clone()
+}
+
+// Scene returns a copy of the current scene, including changes that have not
+// been presented by an update yet.
+func (l *Loop) Scene() Scene {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sceneLocked()
+}
+
+// Frame renders the scene presented by the last update into an image and
+// returns it with its sequence number.
+func (l *Loop) Frame() (*image.RGBA, uint64) {
+	l.mu.Lock()
+	s, seq, size := l.presented.clone(), l.frameSeq, l.sizeLocked()
+	l.mu.Unlock()
+	return s.Render(size), seq
+}
+
+// CanvasSize returns the size of the canvas of the Loop.
+func (l *Loop) CanvasSize() image.Point {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sizeLocked()
+}
+
+func (l *Loop) sizeLocked() image.Point {
+	if l.Size == (image.Point{}) {
+		return DefaultSize
 	}
+	return l.Size
+}
+
+// FrameSeq returns the number of updates presented so far.
+func (l *Loop) FrameSeq() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.frameSeq
+}
+
+// Stats describes the state of a Loop for debugging.
+type Stats struct {
+	FrameSeq uint64
+	// Queued is the number of operations waiting in the queue.
+	Queued  int
+	Figures int
+	// LastOp is the type name of the last handled operation.
+	LastOp string
+}
+
+// Stats returns the current Stats of the Loop.
+func (l *Loop) Stats() Stats {
+	queued := l.mq.len()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := Stats{FrameSeq: l.frameSeq, Queued: queued, Figures: len(l.figures)}
+	if l.lastOp != nil {
+		s.LastOp = opName(l.lastOp)
+	}
+	return s
+}
+
+// Subscribe returns a channel of events for every operation the Loop
+// handles and a function that cancels the subscription. Events are dropped
+// for subscribers that do not keep up. The channel is closed when the Loop
+// stops.
+func (l *Loop) Subscribe() (<-chan Event, func()) {
+	return l.events.subscribe()
 }
 
 func (l *Loop) Post(op Operation) {
 	l.mq.push(op)
 }
 
+// StopAndWait handles the operations posted so far and stops the Loop.
+// Frames are no longer presented once the Receiver holds all the textures. Its
+// textures are released, the ones leased to the Receiver once they are given
+// back, and the event subscriptions are closed.
 func (l *Loop) StopAndWait() {
-	l.stopReq = true
+	l.stopReq.Store(true)
+	l.stopOnce.Do(func() { close(l.stopping) })
 	<-l.stopped
+	l.releaseTextures()
+	l.events.close()
 }
 
 type messageQueue struct {
@@ -163,19 +508,14 @@ func (mq *messageQueue) pull() Operation {
 	return op
 }
 
-func (mq *messageQueue) empty() bool {
+func (mq *messageQueue) len() int {
 	mq.mu.Lock()
 	defer mq.mu.Unlock()
-	return len(mq.ops) == 0
+	return len(mq.ops)
 }
 
-func drawT180(t screen.Texture, cx, cy, size int, col color.RGBA) {
-	thickness := size / 5
-	half := size / 2
-
-	horzRect := image.Rect(cx-half, cy-thickness/2, cx+half, cy+thickness/2)
-	t.Fill(horzRect, col, screen.Src)
-
-	vertRect := image.Rect(cx-thickness/2, cy-half, cx+thickness/2, cy+thickness/2)
-	t.Fill(vertRect, col, screen.Src)
+func (mq *messageQueue) empty() bool {
+	mq.mu.Lock()
+	defer mq.mu.Unlock()
+	return len(mq.ops) == 0
 }
@@ -5,7 +5,9 @@ import (
 	"image/color"
 	"image/draw"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"golang.org/x/exp/shiny/screen"
 )
@@ -109,16 +111,20 @@ func logOp(t *testing.T, msg string, op Operation) Operation {
 
 type testReceiver struct {
 	lastTexture screen.Texture
+	release     func()
 }
 
-func (tr *testReceiver) Update(t screen.Texture) {
-	tr.lastTexture = t
+func (tr *testReceiver) Update(t screen.Texture, release func()) {
+	if tr.release != nil {
+		tr.release()
+	}
+	tr.lastTexture, tr.release = t, release
 }
 
 type mockScreen struct{}
 
 func (m mockScreen) NewBuffer(size image.Point) (screen.Buffer, error) {
-	panic("not implemented")
+	return newMemBuffer(size), nil
 }
 
 func (m mockScreen) NewTexture(size image.Point) (screen.Texture, error) {
@@ -155,3 +161,332 @@ func (m *mockTexture) Fill(dr image.Rectangle, src color.Color, op draw.Op) {
 		})
 	}
 }
+
+func TestLoop_StartPresentsInitialFrame(t *testing.T) {
+	var l Loop
+	tr := &testReceiver{}
+	l.Receiver = tr
+
+	l.Start(nil)
+	l.StopAndWait()
+
+	if tr.lastTexture == nil {
+		t.Fatal("Start did not present a frame")
+	}
+	img, seq := l.Frame()
+	if seq != 1 {
+		t.Errorf("frame seq = %d, want 1", seq)
+	}
+	initial := DefaultScene(DefaultSize)
+	want := initial.Render(DefaultSize)
+	if !reflect.DeepEqual(img, want) {
+		t.Error("the initial frame is not the default scene")
+	}
+}
+
+func TestLoop_MoveFigure(t *testing.T) {
+	var l Loop
+	l.Start(nil)
+	l.Post(Reset{})
+	l.Post(DrawT180{PosX: 10, PosY: 10, Size: 10})
+	l.Post(DrawT180{PosX: 20, PosY: 20, Size: 10})
+	l.Post(MoveFigure{Index: -1, By: image.Pt(5, -5)})
+	l.Post(MoveFigure{Index: 0, By: image.Pt(1, 1)})
+	l.Post(MoveFigure{Index: 2, By: image.Pt(100, 100)})
+	l.StopAndWait()
+
+	got := l.Scene().Figures
+	if got[0].PosX != 11 || got[0].PosY != 11 || got[1].PosX != 25 || got[1].PosY != 15 {
+		t.Errorf("figures = %+v, want the first at (11, 11) and the last at (25, 15)", got)
+	}
+}
+
+func TestLoop_FigureAt(t *testing.T) {
+	var l Loop
+	l.Start(nil)
+	l.Post(Reset{})
+	l.Post(DrawT180{PosX: 100, PosY: 100, Size: 100})
+	l.Post(DrawT180{PosX: 120, PosY: 100, Size: 100})
+	l.Post(ResizeFigure{Index: 0, By: -200})
+	l.StopAndWait()
+
+	if i, ok := l.FigureAt(image.Pt(130, 100)); !ok || i != 1 {
+		t.Errorf("FigureAt(130, 100) = %d, %t, want the top figure 1", i, ok)
+	}
+	if i, ok := l.FigureAt(image.Pt(100, 100)); !ok || i != 1 {
+		t.Errorf("FigureAt(100, 100) = %d, %t, want 1", i, ok)
+	}
+	if _, ok := l.FigureAt(image.Pt(300, 300)); ok {
+		t.Error("FigureAt(300, 300) found a figure on the background")
+	}
+	if got := l.Scene().Figures[0].Size; got != MinFigureSize {
+		t.Errorf("resized figure size = %d, want %d", got, MinFigureSize)
+	}
+}
+
+func TestLoop_HugeFigure(t *testing.T) {
+	var l Loop
+	l.Start(nil)
+	l.Post(Reset{})
+	l.Post(DrawT180{PosX: 400, PosY: 400, Size: 3000})
+	l.Post(ResizeFigure{Index: 0, By: 1 << 30})
+	l.StopAndWait()
+
+	if got, want := l.Scene().Figures[0].Size, MaxFigureSize(DefaultSize); got != want {
+		t.Errorf("resized figure size = %d, want %d", got, want)
+	}
+	if i, ok := l.FigureAt(image.Pt(400, 400)); !ok || i != 0 {
+		t.Errorf("FigureAt(400, 400) = %d, %t, want 0", i, ok)
+	}
+	if _, ok := l.FigureAt(image.Pt(-1000, 400)); ok {
+		t.Error("FigureAt(-1000, 400) found a figure off the canvas")
+	}
+}
+
+// sceneReceiver reads the scene of the Loop that sends it frames.
+type sceneReceiver struct {
+	l       *Loop
+	updates int
+}
+
+func (r *sceneReceiver) Update(_ screen.Texture, release func()) {
+	defer release()
+	r.l.Scene()
+	r.updates++
+}
+
+func TestLoop_ReceiverMayQueryLoop(t *testing.T) {
+	var l Loop
+	r := &sceneReceiver{l: &l}
+	l.Receiver = r
+	l.Start(nil)
+	l.Post(OperationList{UpdateOp, UpdateOp})
+	l.StopAndWait()
+
+	if r.updates != 3 {
+		t.Errorf("Receiver got %d frames, want 3", r.updates)
+	}
+}
+
+func TestLoop_Stats(t *testing.T) {
+	var l Loop
+	l.Start(nil)
+	l.Post(DrawT180{PosX: 10, PosY: 10, Size: 10})
+	l.Post(UpdateOp)
+	l.Post(Move{NewPos: image.Pt(1, 1)})
+	l.StopAndWait()
+
+	want := Stats{FrameSeq: 2, Figures: 2, LastOp: "Move"}
+	if got := l.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+// holdingReceiver keeps every frame for a while on another goroutine and
+// checks that the Loop does not draw into it until it is released. Run with
+// -race to also catch unsynchronised access.
+type holdingReceiver struct {
+	t  *testing.T
+	wg sync.WaitGroup
+}
+
+func (r *holdingReceiver) Update(t screen.Texture, release func()) {
+	img := t.(*memTexture).img
+	want := img.RGBAAt(0, 0)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer release()
+		for range 20 {
+			if got := img.RGBAAt(0, 0); got != want {
+				r.t.Errorf("leased frame changed from %v to %v", want, got)
+				return
+			}
+			time.Sleep(50 * time.Microsecond)
+		}
+	}()
+}
+
+func TestLoop_TextureOwnership(t *testing.T) {
+	r := &holdingReceiver{t: t}
+	l := Loop{Receiver: r, Size: image.Pt(16, 16)}
+	l.Start(nil)
+	for i := range 50 {
+		l.Post(FillBackground{Color: color.RGBA{uint8(i), 0, 0, 255}})
+		l.Post(UpdateOp)
+	}
+	l.StopAndWait()
+	r.wg.Wait()
+}
+
+// releaseScreen counts the textures and buffers it creates and releases.
+type releaseScreen struct {
+	mockScreen
+	mu                 sync.Mutex
+	created, released  int
+	buffers, bufsFreed int
+}
+
+func (s *releaseScreen) NewBuffer(size image.Point) (screen.Buffer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffers++
+	return &releaseBuffer{memBuffer: newMemBuffer(size), s: s}, nil
+}
+
+func (s *releaseScreen) NewTexture(size image.Point) (screen.Texture, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created++
+	return &releaseTexture{s: s}, nil
+}
+
+func (s *releaseScreen) counts() (created, released, buffers, bufsFreed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.created, s.released, s.buffers, s.bufsFreed
+}
+
+type releaseTexture struct {
+	mockTexture
+	s *releaseScreen
+}
+
+func (t *releaseTexture) Release() {
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	t.s.released++
+}
+
+type releaseBuffer struct {
+	*memBuffer
+	s *releaseScreen
+}
+
+func (b *releaseBuffer) Release() {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	b.s.bufsFreed++
+}
+
+func TestLoop_ReleasesTextures(t *testing.T) {
+	var s releaseScreen
+	tr := &testReceiver{}
+	l := Loop{Receiver: tr}
+	l.Start(&s)
+	for range 5 {
+		l.Post(UpdateOp)
+	}
+	l.StopAndWait()
+
+	// The texture still shown is released when the Receiver gives it back.
+	if created, released, buffers, freed := s.counts(); created != poolSize || released != poolSize-1 || freed != buffers {
+		t.Errorf("after stop: %d of %d textures and %d of %d buffers released, want %d textures and all buffers",
+			released, created, freed, buffers, poolSize-1)
+	}
+	tr.release()
+	tr.release()
+	if created, released, _, _ := s.counts(); released != created {
+		t.Errorf("%d of %d textures released after the last was given back", released, created)
+	}
+}
+
+func TestLoop_StopClosesSubscriptions(t *testing.T) {
+	var l Loop
+	l.Start(nil)
+	events, cancel := l.Subscribe()
+	l.Post(UpdateOp)
+	l.StopAndWait()
+
+	n := 0
+	for range events {
+		n++
+	}
+	if n == 0 {
+		t.Error("no events before the subscription was closed")
+	}
+	cancel()
+
+	late, _ := l.Subscribe()
+	if _, ok := <-late; ok {
+		t.Error("subscribing to a stopped Loop returned an open channel")
+	}
+}
+
+func TestLoop_AddFigure(t *testing.T) {
+	var (
+		l     Loop
+		added = make(chan int, 1)
+	)
+	l.Start(nil)
+	l.Post(Reset{})
+	l.Post(DrawT180{PosX: 10, PosY: 10, Size: 10})
+	l.Post(AddFigure{Figure: DrawT180{PosX: 20, PosY: 20, Size: 10}, Added: func(i int) { added <- i }})
+	l.Post(DrawT180{PosX: 30, PosY: 30, Size: 10})
+	l.StopAndWait()
+
+	if i := <-added; i != 1 {
+		t.Errorf("Added got index %d, want 1", i)
+	}
+	if f := l.Scene().Figures[1]; f.PosX != 20 {
+		t.Errorf("figure 1 = %+v, want the added one", f)
+	}
+}
+
+// greedyReceiver never gives frames back.
+type greedyReceiver struct{}
+
+func (greedyReceiver) Update(screen.Texture, func()) {}
+
+func TestLoop_StopsWhileReceiverHoldsFrames(t *testing.T) {
+	l := Loop{Receiver: greedyReceiver{}, Size: image.Pt(16, 16)}
+	l.Start(nil)
+	for range poolSize + 2 {
+		l.Post(UpdateOp)
+	}
+	l.Post(DrawT180{PosX: 1, PosY: 1, Size: 10})
+
+	done := make(chan struct{})
+	go func() {
+		l.StopAndWait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("StopAndWait() did not return while the Receiver held every texture")
+	}
+	// Operations are still handled, only their frames are not presented.
+	if got := len(l.Scene().Figures); got != 2 {
+		t.Errorf("scene has %d figures, want 2", got)
+	}
+}
+
+// firstFrameReceiver keeps the colour of the first frame it gets.
+type firstFrameReceiver struct {
+	frames int
+	first  color.RGBA
+}
+
+func (r *firstFrameReceiver) Update(t screen.Texture, release func()) {
+	defer release()
+	if r.frames++; r.frames == 1 {
+		r.first = t.(*memTexture).img.RGBAAt(0, 0)
+	}
+}
+
+func TestLoop_OpsPostedBeforeStart(t *testing.T) {
+	var (
+		r firstFrameReceiver
+		l = Loop{Receiver: &r}
+	)
+	white := color.RGBA{255, 255, 255, 255}
+	l.Post(OperationList{Reset{}, FillBackground{Color: white}, UpdateOp})
+	l.Start(nil)
+	l.StopAndWait()
+
+	// The initial green scene is never shown.
+	if r.frames != 1 || r.first != white {
+		t.Errorf("got %d frames, the first %v; want 1 white frame", r.frames, r.first)
+	}
+}
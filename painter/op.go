@@ -1,10 +1,11 @@
 package painter
 
 import (
-	"golang.org/x/exp/shiny/imageutil"
 	"image"
 	"image/color"
 
+	"github.com/roman-mazur/architecture-lab-3/painter/geom"
+	"golang.org/x/exp/shiny/imageutil"
 	"golang.org/x/exp/shiny/screen"
 )
 
@@ -48,7 +49,7 @@ type BgRect struct {
 }
 
 func (op BgRect) Do(t screen.Texture) bool {
-	t.Fill(op.Rect, color.Black, screen.Src)
+	t.Fill(op.Rect, color.Black, screen.Over)
 	return false
 }
 
@@ -56,28 +57,72 @@ type DrawT180 struct {
 	PosX, PosY int
 	Size       int
 	Color      color.RGBA
+	// Rotate turns the figure clockwise around its centre, in degrees.
+	Rotate float64
+	// OutlineWidth pixels wide Outline is drawn along the edges of the
+	// figure if the width is positive.
+	Outline      color.RGBA
+	OutlineWidth int
+	// Opacity fades the figure, from 0 to 1; zero stands for 1. Blend is
+	// how the figure mixes with what is under it.
+	Opacity float64
+	Blend   Blend
 }
 
 func (op DrawT180) Do(t screen.Texture) bool {
-	b := t.Bounds()
+	op.draw(t)
+	return false
+}
 
-	cx := op.PosX
-	cy := op.PosY
-	if cx == 0 || cy == 0 {
-		cx = b.Dx() / 2
-		cy = b.Dy() / 2
-	}
+// Geometry returns the shape of the figure.
+func (op DrawT180) Geometry() geom.T180 {
+	return geom.T180{Center: image.Pt(op.PosX, op.PosY), Size: op.Size, Rotate: op.Rotate}
+}
 
-	thickness := op.Size / 5
-	half := op.Size / 2
+func (op DrawT180) style() style {
+	return style{op.Opacity, op.Blend}
+}
+
+func (op DrawT180) draw(t filler) {
+	g := op.Geometry()
+	c := op.style().fade(op.Color)
+	if op.Rotate == 0 && op.OutlineWidth <= 0 {
+		for _, r := range g.Rects() {
+			t.Fill(r, c, screen.Over)
+		}
+		return
+	}
 
-	horzRect := image.Rect(cx-half, cy-thickness/2, cx+half, cy+thickness/2)
-	t.Fill(horzRect, op.Color, screen.Src)
+	shape := g.Polygon()
+	fillPolygons(t, [][]geom.Point{shape}, c)
+	if op.OutlineWidth > 0 {
+		outline := geom.StrokePath(shape, true, float64(op.OutlineWidth), geom.JoinMiter, geom.CapButt)
+		fillPolygons(t, outline, op.style().fade(op.Outline))
+	}
+}
 
-	vertRect := image.Rect(cx-thickness/2, cy-half, cx+thickness/2, cy+thickness/2)
-	t.Fill(vertRect, op.Color, screen.Src)
+// render draws the figure with anti-aliased edges.
+func (op DrawT180) render(r *renderer) {
+	g := op.Geometry()
+	if op.Rotate == 0 {
+		for _, rect := range g.Rects() {
+			r.fill([][]geom.Point{rectPolygon(rect)}, op.Color)
+		}
+	} else {
+		r.fill([][]geom.Point{g.Polygon()}, op.Color)
+	}
+	if op.OutlineWidth > 0 {
+		r.stroke(g.Polygon(), true, float64(op.OutlineWidth), geom.JoinMiter, op.Outline)
+	}
+}
 
-	return false
+// fillPolygons fills the union of polys, one pixel high span at a time, so
+// that it works on any texture that can fill rectangles.
+func fillPolygons(t filler, polys [][]geom.Point, col color.Color) {
+	b := t.Bounds()
+	geom.Spans(polys, &b, func(r image.Rectangle) {
+		t.Fill(r, col, screen.Over)
+	})
 }
 
 type Border struct {
@@ -85,11 +130,18 @@ type Border struct {
 	Color     color.Color
 }
 
+// render draws the border along the edges of the image.
+func (op Border) render(r *renderer) {
+	for _, rect := range imageutil.Border(r.img.Bounds(), op.Thickness) {
+		r.fill([][]geom.Point{rectPolygon(rect)}, op.Color)
+	}
+}
+
 func (op Border) Do(t screen.Texture) bool {
 	bounds := t.Bounds()
 	borders := imageutil.Border(bounds, op.Thickness)
 	for _, r := range borders {
-		t.Fill(r, op.Color, screen.Src)
+		t.Fill(r, op.Color, screen.Over)
 	}
 	return false
 }
@@ -109,6 +161,56 @@ func (Move) Do(t screen.Texture) bool {
 	return false
 }
 
+// MoveFigure moves one figure by By. Index counts figures in the order they
+// were added; negative values count from the last one, so -1 is the figure
+// drawn on top. Figures that do not exist are left alone.
+type MoveFigure struct {
+	Index int
+	By    image.Point
+}
+
+func (MoveFigure) Do(t screen.Texture) bool {
+	return false
+}
+
+// ResizeFigure changes the size of one figure by By pixels, counting Index
+// like MoveFigure. Figures do not get smaller than MinFigureSize or larger
+// than MaxFigureSize.
+type ResizeFigure struct {
+	Index int
+	By    int
+}
+
+func (ResizeFigure) Do(t screen.Texture) bool {
+	return false
+}
+
+// AddFigure draws Figure like DrawT180 and then calls Added with its index,
+// so that the caller learns it even if other operations are queued before.
+// Added is called on the Loop goroutine and must not call the Loop.
+type AddFigure struct {
+	Figure DrawT180
+	Added  func(index int)
+}
+
+func (op AddFigure) Do(t screen.Texture) bool {
+	return op.Figure.Do(t)
+}
+
+// MinFigureSize is the smallest size ResizeFigure leaves a figure with.
+const MinFigureSize = 10
+
+// MaxScale is how many times larger than the canvas figures, shapes and
+// sprites may be, so that a single command cannot make every frame and
+// hit-test walk millions of rows.
+const MaxScale = 4
+
+// MaxFigureSize returns the largest size and outline width of a figure on a
+// canvas of the given size. ResizeFigure does not make figures larger.
+func MaxFigureSize(canvas image.Point) int {
+	return MaxScale * max(canvas.X, canvas.Y)
+}
+
 var (
 	WhiteFill = OperationFunc(func(t screen.Texture) {
 		t.Fill(t.Bounds(), color.White, screen.Src)
@@ -0,0 +1,234 @@
+package painter
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"regexp"
+	"slices"
+	"sync"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// DefaultCanvas is the canvas that always exists and is shown first.
+const DefaultCanvas = "default"
+
+var (
+	ErrCanvasExists    = errors.New("canvas already exists")
+	ErrCanvasNotFound  = errors.New("canvas not found")
+	ErrTooManyCanvases = errors.New("canvas limit reached")
+)
+
+var canvasName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Registry holds named canvases, each with its own Loop and scene. Only the
+// shown canvas sends its frames to the Receiver.
+type Registry struct {
+	// Receiver gets the frames of the shown canvas.
+	Receiver Receiver
+	// Max limits the number of canvases, including the default one. Zero
+	// means no limit.
+	Max int
+	// Size, Initial and Assets are passed on to the Loop of every canvas.
+	Size    image.Point
+	Initial *Scene
+	Assets  *Assets
+
+	mu      sync.Mutex
+	screen  screen.Screen
+	started bool
+	loops   map[string]*Loop
+	shown   string
+}
+
+// Start starts all canvases on s, creating the default one. A nil screen
+// runs the canvases headless.
+func (r *Registry) Start(s screen.Screen) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initLocked()
+	r.screen = s
+	r.started = true
+	for _, l := range r.loops {
+		l.Start(s)
+	}
+}
+
+func (r *Registry) initLocked() {
+	if r.loops != nil {
+		return
+	}
+	def := r.newLoop()
+	def.Receiver = r.Receiver
+	r.loops = map[string]*Loop{DefaultCanvas: def}
+	r.shown = DefaultCanvas
+	if r.started {
+		def.Start(r.screen)
+	}
+}
+
+func (r *Registry) newLoop() *Loop {
+	l := &Loop{Size: r.Size, Assets: r.Assets}
+	if r.Initial != nil {
+		initial := r.Initial.clone()
+		l.Initial = &initial
+	}
+	return l
+}
+
+// Get returns the named canvas.
+func (r *Registry) Get(name string) (*Loop, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initLocked()
+	l, ok := r.loops[name]
+	return l, ok
+}
+
+// Default returns the default canvas.
+func (r *Registry) Default() *Loop {
+	l, _ := r.Get(DefaultCanvas)
+	return l
+}
+
+// Create adds a new canvas.
+func (r *Registry) Create(name string) (*Loop, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initLocked()
+	if _, ok := r.loops[name]; ok {
+		return nil, ErrCanvasExists
+	}
+	return r.createLocked(name)
+}
+
+// GetOrCreate returns the named canvas, creating it if needed.
+func (r *Registry) GetOrCreate(name string) (*Loop, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initLocked()
+	if l, ok := r.loops[name]; ok {
+		return l, nil
+	}
+	return r.createLocked(name)
+}
+
+func (r *Registry) createLocked(name string) (*Loop, error) {
+	if !canvasName.MatchString(name) {
+		return nil, fmt.Errorf("invalid canvas name %q", name)
+	}
+	if r.Max > 0 && len(r.loops) >= r.Max {
+		return nil, ErrTooManyCanvases
+	}
+	l := r.newLoop()
+	r.loops[name] = l
+	if r.started {
+		l.Start(r.screen)
+	}
+	return l, nil
+}
+
+// Delete stops and removes a canvas. The default canvas cannot be deleted;
+// if the shown canvas is deleted, the default one is shown instead.
+func (r *Registry) Delete(name string) error {
+	r.mu.Lock()
+	l, ok := r.loops[name]
+	if !ok {
+		r.mu.Unlock()
+		return ErrCanvasNotFound
+	}
+	if name == DefaultCanvas {
+		r.mu.Unlock()
+		return fmt.Errorf("the %s canvas cannot be deleted", DefaultCanvas)
+	}
+	delete(r.loops, name)
+	if r.shown == name {
+		r.showLocked(DefaultCanvas)
+	}
+	started := r.started
+	r.mu.Unlock()
+
+	l.SetReceiver(nil)
+	if started {
+		l.StopAndWait()
+	}
+	return nil
+}
+
+// Names returns the canvas names in sorted order.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initLocked()
+	names := make([]string, 0, len(r.loops))
+	for name := range r.loops {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Shown returns the name of the canvas sent to the Receiver.
+func (r *Registry) Shown() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initLocked()
+	return r.shown
+}
+
+// Show makes the named canvas the one sent to the Receiver.
+func (r *Registry) Show(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.initLocked()
+	if _, ok := r.loops[name]; !ok {
+		return ErrCanvasNotFound
+	}
+	r.showLocked(name)
+	return nil
+}
+
+// ShowNext shows the canvas after the current one in name order, or the one
+// before it if forward is false.
+func (r *Registry) ShowNext(forward bool) string {
+	names := r.Names()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := slices.Index(names, r.shown)
+	if forward {
+		i = (i + 1) % len(names)
+	} else {
+		i = (i - 1 + len(names)) % len(names)
+	}
+	r.showLocked(names[i])
+	return r.shown
+}
+
+func (r *Registry) showLocked(name string) {
+	if old, ok := r.loops[r.shown]; ok && r.shown != name {
+		old.SetReceiver(nil)
+	}
+	r.shown = name
+	l := r.loops[name]
+	l.SetReceiver(r.Receiver)
+	// Present the new canvas right away instead of on its next update.
+	l.Post(UpdateOp)
+}
+
+// StopAndWait stops all canvases.
+func (r *Registry) StopAndWait() {
+	r.mu.Lock()
+	loops := make([]*Loop, 0, len(r.loops))
+	for _, l := range r.loops {
+		loops = append(loops, l)
+	}
+	started := r.started
+	r.mu.Unlock()
+	if !started {
+		return
+	}
+	for _, l := range loops {
+		l.StopAndWait()
+	}
+}
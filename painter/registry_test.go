@@ -0,0 +1,102 @@
+package painter
+
+import (
+	"errors"
+	"image/color"
+	"reflect"
+	"sync"
+	"testing"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+type countingReceiver struct {
+	mu      sync.Mutex
+	updates int
+}
+
+func (r *countingReceiver) Update(_ screen.Texture, release func()) {
+	release()
+	r.mu.Lock()
+	r.updates++
+	r.mu.Unlock()
+}
+
+func (r *countingReceiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.updates
+}
+
+func TestRegistry(t *testing.T) {
+	var rcv countingReceiver
+	r := Registry{Receiver: &rcv, Max: 3}
+	r.Start(nil)
+
+	a, err := r.Create("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Create("a"); !errors.Is(err, ErrCanvasExists) {
+		t.Errorf("Create(a) twice: err = %v, want ErrCanvasExists", err)
+	}
+	b, err := r.GetOrCreate("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bEvents, _ := b.Subscribe()
+	if _, err := r.GetOrCreate("c"); !errors.Is(err, ErrTooManyCanvases) {
+		t.Errorf("GetOrCreate(c) over the limit: err = %v, want ErrTooManyCanvases", err)
+	}
+	if _, err := r.Create("bad name"); err == nil {
+		t.Error("Create accepted an invalid name")
+	}
+	if got, want := r.Names(), []string{"a", "b", DefaultCanvas}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+
+	// Canvases keep separate scenes.
+	a.Post(FillBackground{Color: color.RGBA{255, 255, 255, 255}})
+	a.Post(UpdateOp)
+	if err := r.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	for range bEvents {
+		// Subscribers of a deleted canvas are let go.
+	}
+	if err := r.Delete(DefaultCanvas); err == nil {
+		t.Error("Delete removed the default canvas")
+	}
+
+	// Only the shown canvas reaches the receiver.
+	if err := r.Show("a"); err != nil {
+		t.Fatal(err)
+	}
+	if receiverOf(a) != &rcv || receiverOf(r.Default()) != nil {
+		t.Error("Show(a) did not move the receiver to canvas a")
+	}
+	if got := r.ShowNext(true); got != DefaultCanvas {
+		t.Errorf("ShowNext() = %q, want %q", got, DefaultCanvas)
+	}
+	if receiverOf(a) != nil || receiverOf(r.Default()) != &rcv {
+		t.Error("ShowNext() did not move the receiver back to the default canvas")
+	}
+
+	r.StopAndWait()
+
+	if got := a.Scene().Background; got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("canvas a background = %v, want white", got)
+	}
+	if got := r.Default().Scene().Background; got == (color.RGBA{255, 255, 255, 255}) {
+		t.Error("the default canvas got the background of canvas a")
+	}
+	if rcv.count() == 0 {
+		t.Error("switching canvases did not present a frame")
+	}
+}
+
+func receiverOf(l *Loop) Receiver {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Receiver
+}
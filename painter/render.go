@@ -0,0 +1,138 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"github.com/roman-mazur/architecture-lab-3/painter/geom"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/vector"
+)
+
+// renderer draws anti-aliased shapes into an image. Shapes with edges on
+// whole pixels cover them fully, so they look the same as when drawn with
+// Texture.Fill.
+type renderer struct {
+	img *image.RGBA
+	z   vector.Rasterizer
+	// assets are where sprites are drawn from.
+	assets *Assets
+	// style is how the object being drawn is composited.
+	style style
+}
+
+func newRenderer(img *image.RGBA) *renderer {
+	return &renderer{img: img}
+}
+
+// rect fills r with c, replacing what was there.
+func (r *renderer) rect(rect image.Rectangle, c color.Color) {
+	draw.Draw(r.img, rect, image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// fill paints c over the union of polys by the non-zero winding rule.
+// Polygons going opposite ways cancel out where they overlap.
+func (r *renderer) fill(polys [][]geom.Point, c color.Color) {
+	clip := polyBounds(polys).Intersect(r.img.Bounds())
+	if clip.Empty() {
+		return
+	}
+	// The rasterizer only covers the clip rectangle, to keep drawing small
+	// shapes on a big canvas cheap.
+	r.z.Reset(clip.Dx(), clip.Dy())
+	ox, oy := float32(clip.Min.X), float32(clip.Min.Y)
+	for _, poly := range polys {
+		if len(poly) < 3 {
+			continue
+		}
+		r.z.MoveTo(float32(poly[0].X)-ox, float32(poly[0].Y)-oy)
+		for _, p := range poly[1:] {
+			r.z.LineTo(float32(p.X)-ox, float32(p.Y)-oy)
+		}
+		r.z.ClosePath()
+	}
+	if r.style.normal() {
+		r.z.Draw(r.img, clip, image.NewUniform(r.style.fade(c)), image.Point{})
+		return
+	}
+	mask := image.NewAlpha(clip)
+	r.z.Draw(mask, clip, image.Opaque, image.Point{})
+	r.mask(clip, mask, c)
+}
+
+// mask paints c on at through mask, whose top left corner goes to at.Min.
+func (r *renderer) mask(at image.Rectangle, mask *image.Alpha, c color.Color) {
+	f := r.style.fade(c)
+	if r.style.normal() {
+		draw.DrawMask(r.img, at, image.NewUniform(f), image.Point{}, mask, mask.Rect.Min, draw.Over)
+		return
+	}
+	d := mask.Rect.Min.Sub(at.Min)
+	composite(r.img, at, r.style.blend, func(x, y int) color.RGBA {
+		return scaleColor(f, float64(mask.AlphaAt(x+d.X, y+d.Y).A)/255)
+	})
+}
+
+// image paints src on dst, scaled to its size.
+func (r *renderer) image(dst image.Rectangle, src *image.RGBA) {
+	alpha := r.style.alpha()
+	if r.style.normal() && alpha == 1 {
+		if dst.Size() == src.Rect.Size() {
+			draw.Draw(r.img, dst, src, src.Rect.Min, draw.Over)
+			return
+		}
+		xdraw.BiLinear.Scale(r.img, dst, src, src.Rect, xdraw.Over, nil)
+		return
+	}
+	visible := dst.Intersect(r.img.Bounds())
+	if visible.Empty() {
+		return
+	}
+	if dst.Size() != src.Rect.Size() {
+		// Only the visible part is scaled, so that big sprites do not take
+		// memory for pixels off the canvas. The scaler clips dst to the
+		// bounds of scaled and keeps the mapping of the whole sprite.
+		scaled := image.NewRGBA(visible)
+		xdraw.BiLinear.Scale(scaled, dst, src, src.Rect, xdraw.Src, nil)
+		src, dst = scaled, visible
+	}
+	sp := src.Rect.Min.Add(visible.Min.Sub(dst.Min))
+	if r.style.normal() {
+		fade := image.NewUniform(color.Alpha{uint8(math.Round(alpha * 255))})
+		draw.DrawMask(r.img, visible, src, sp, fade, image.Point{}, draw.Over)
+		return
+	}
+	d := sp.Sub(visible.Min)
+	composite(r.img, visible, r.style.blend, func(x, y int) color.RGBA {
+		return scaleColor(src.RGBAAt(x+d.X, y+d.Y), alpha)
+	})
+}
+
+// stroke paints a line of the given width along pts.
+func (r *renderer) stroke(pts []geom.Point, closed bool, width float64, join geom.Join, c color.Color) {
+	r.fill(geom.StrokePath(pts, closed, width, join, geom.CapButt), c)
+}
+
+// polyBounds returns the pixels touched by polys.
+func polyBounds(polys [][]geom.Point) image.Rectangle {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, poly := range polys {
+		for _, p := range poly {
+			minX, minY = min(minX, p.X), min(minY, p.Y)
+			maxX, maxY = max(maxX, p.X), max(maxY, p.Y)
+		}
+	}
+	if minX > maxX {
+		return image.Rectangle{}
+	}
+	return image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX)), int(math.Ceil(maxY)))
+}
+
+// rectPolygon returns r as a polygon.
+func rectPolygon(r image.Rectangle) []geom.Point {
+	x0, y0, x1, y1 := float64(r.Min.X), float64(r.Min.Y), float64(r.Max.X), float64(r.Max.Y)
+	return []geom.Point{{X: x0, Y: y0}, {X: x1, Y: y0}, {X: x1, Y: y1}, {X: x0, Y: y1}}
+}
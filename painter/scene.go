@@ -0,0 +1,330 @@
+package painter
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/roman-mazur/architecture-lab-3/painter/geom"
+	"golang.org/x/exp/shiny/imageutil"
+	"golang.org/x/exp/shiny/screen"
+)
+
+// Scene is the state the Loop draws on every update.
+type Scene struct {
+	Background color.RGBA
+	BgRect     *image.Rectangle
+	Border     *Border
+	Figures    []DrawT180
+	// Shapes are drawn over the figures, in order.
+	Shapes []Shape
+	// Assets are where sprites get their images when the scene is drawn.
+	// Scenes of a Loop use its Assets.
+	Assets *Assets
+}
+
+// SetScene replaces the whole scene of the Loop.
+type SetScene struct {
+	Scene Scene
+}
+
+func (op SetScene) Do(t screen.Texture) bool {
+	op.Scene.draw(t)
+	return false
+}
+
+// filler is the part of screen.Texture needed to draw a scene.
+type filler interface {
+	Bounds() image.Rectangle
+	Fill(dr image.Rectangle, src color.Color, op draw.Op)
+}
+
+func (s *Scene) draw(t filler) {
+	t.Fill(t.Bounds(), s.Background, screen.Src)
+
+	if s.BgRect != nil {
+		t.Fill(*s.BgRect, color.Black, screen.Over)
+	}
+
+	for _, f := range s.Figures {
+		f.draw(t)
+	}
+	for _, sh := range s.Shapes {
+		sh.draw(t)
+	}
+
+	if s.Border != nil {
+		for _, r := range imageutil.Border(t.Bounds(), s.Border.Thickness) {
+			t.Fill(r, s.Border.Color, screen.Over)
+		}
+	}
+}
+
+// render draws the scene into img with anti-aliasing. This is how the Loop
+// draws its frames; draw is left for operations applied to a texture
+// directly.
+func (s *Scene) render(img *image.RGBA) {
+	r := newRenderer(img)
+	r.assets = s.Assets
+	r.rect(img.Bounds(), s.Background)
+
+	if s.BgRect != nil {
+		r.fill([][]geom.Point{rectPolygon(*s.BgRect)}, color.Black)
+	}
+
+	for _, f := range s.Figures {
+		r.style = f.style()
+		f.render(r)
+	}
+	for _, sh := range s.Shapes {
+		r.style = sh.style()
+		sh.render(r)
+	}
+	r.style = style{}
+
+	if s.Border != nil {
+		s.Border.render(r)
+	}
+}
+
+// Render draws the scene into a new image of the given size.
+func (s *Scene) Render(size image.Point) *image.RGBA {
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	s.render(img)
+	return img
+}
+
+func (s Scene) clone() Scene {
+	c := s
+	if s.BgRect != nil {
+		r := *s.BgRect
+		c.BgRect = &r
+	}
+	if s.Border != nil {
+		b := *s.Border
+		c.Border = &b
+	}
+	c.Figures = append([]DrawT180(nil), s.Figures...)
+	c.Shapes = nil
+	for _, sh := range s.Shapes {
+		c.Shapes = append(c.Shapes, sh.clone())
+	}
+	return c
+}
+
+type rectJSON struct {
+	X1 int `json:"x1"`
+	Y1 int `json:"y1"`
+	X2 int `json:"x2"`
+	Y2 int `json:"y2"`
+}
+
+type borderJSON struct {
+	Thickness int    `json:"thickness"`
+	Color     string `json:"color"`
+}
+
+type outlineJSON struct {
+	Width int    `json:"width"`
+	Color string `json:"color"`
+}
+
+type figureJSON struct {
+	X       int          `json:"x"`
+	Y       int          `json:"y"`
+	Size    int          `json:"size"`
+	Color   string       `json:"color"`
+	Rotate  float64      `json:"rotate,omitempty"`
+	Outline *outlineJSON `json:"outline,omitempty"`
+	Opacity float64      `json:"opacity,omitempty"`
+	Blend   Blend        `json:"blend,omitempty"`
+}
+
+type pointJSON struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type shapeJSON struct {
+	ID      string      `json:"id"`
+	Kind    ShapeKind   `json:"kind"`
+	Points  []pointJSON `json:"points"`
+	RX      int         `json:"rx,omitempty"`
+	RY      int         `json:"ry,omitempty"`
+	Fill    string      `json:"fill,omitempty"`
+	Stroke  string      `json:"stroke,omitempty"`
+	Width   int         `json:"width,omitempty"`
+	Text    string      `json:"text,omitempty"`
+	Size    int         `json:"size,omitempty"`
+	Align   Align       `json:"align,omitempty"`
+	Asset   string      `json:"asset,omitempty"`
+	W       int         `json:"w,omitempty"`
+	H       int         `json:"h,omitempty"`
+	Opacity float64     `json:"opacity,omitempty"`
+	Blend   Blend       `json:"blend,omitempty"`
+}
+
+type sceneJSON struct {
+	Background string       `json:"background"`
+	BgRect     *rectJSON    `json:"bgrect"`
+	Border     *borderJSON  `json:"border"`
+	Figures    []figureJSON `json:"figures"`
+	Shapes     []shapeJSON  `json:"shapes"`
+}
+
+func (s Scene) MarshalJSON() ([]byte, error) {
+	js := sceneJSON{
+		Background: formatColor(s.Background),
+		Figures:    []figureJSON{},
+		Shapes:     []shapeJSON{},
+	}
+	if r := s.BgRect; r != nil {
+		js.BgRect = &rectJSON{r.Min.X, r.Min.Y, r.Max.X, r.Max.Y}
+	}
+	if b := s.Border; b != nil {
+		js.Border = &borderJSON{Thickness: b.Thickness, Color: formatColor(b.Color)}
+	}
+	for _, f := range s.Figures {
+		fj := figureJSON{X: f.PosX, Y: f.PosY, Size: f.Size, Color: formatColor(f.Color), Rotate: f.Rotate, Opacity: f.Opacity, Blend: f.Blend}
+		if f.OutlineWidth > 0 {
+			fj.Outline = &outlineJSON{Width: f.OutlineWidth, Color: formatColor(f.Outline)}
+		}
+		js.Figures = append(js.Figures, fj)
+	}
+	for _, sh := range s.Shapes {
+		sj := shapeJSON{ID: sh.ID, Kind: sh.Kind, RX: sh.RX, RY: sh.RY, Text: sh.Text, Size: sh.Size, Align: sh.Align, Asset: sh.Asset, W: sh.W, H: sh.H, Opacity: sh.Opacity, Blend: sh.Blend}
+		for _, p := range sh.Points {
+			sj.Points = append(sj.Points, pointJSON{p.X, p.Y})
+		}
+		if sh.Fill.A > 0 {
+			sj.Fill = formatColor(sh.Fill)
+		}
+		if sh.StrokeWidth > 0 {
+			sj.Stroke, sj.Width = formatColor(sh.Stroke), sh.StrokeWidth
+		}
+		js.Shapes = append(js.Shapes, sj)
+	}
+	return json.Marshal(js)
+}
+
+func (s *Scene) UnmarshalJSON(data []byte) error {
+	var js sceneJSON
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	var (
+		res Scene
+		err error
+	)
+	if res.Background, err = parseColor(js.Background); err != nil {
+		return fmt.Errorf("background: %w", err)
+	}
+	if r := js.BgRect; r != nil {
+		rect := image.Rect(r.X1, r.Y1, r.X2, r.Y2)
+		res.BgRect = &rect
+	}
+	if b := js.Border; b != nil {
+		c, err := parseColor(b.Color)
+		if err != nil {
+			return fmt.Errorf("border: %w", err)
+		}
+		res.Border = &Border{Thickness: b.Thickness, Color: c}
+	}
+	for i, f := range js.Figures {
+		c, err := parseColor(f.Color)
+		if err != nil {
+			return fmt.Errorf("figure %d: %w", i, err)
+		}
+		fig := DrawT180{PosX: f.X, PosY: f.Y, Size: f.Size, Color: c, Rotate: f.Rotate, Opacity: f.Opacity, Blend: f.Blend}
+		if f.Size <= 0 {
+			return fmt.Errorf("figure %d: size must be positive, got %d", i, f.Size)
+		}
+		if f.Opacity != 0 {
+			if err := CheckOpacity(f.Opacity); err != nil {
+				return fmt.Errorf("figure %d: %w", i, err)
+			}
+		}
+		if err := CheckBlend(f.Blend); err != nil {
+			return fmt.Errorf("figure %d: %w", i, err)
+		}
+		if o := f.Outline; o != nil {
+			if fig.Outline, err = parseColor(o.Color); err != nil {
+				return fmt.Errorf("figure %d: outline: %w", i, err)
+			}
+			if fig.OutlineWidth = o.Width; o.Width <= 0 {
+				return fmt.Errorf("figure %d: outline width must be positive, got %d", i, o.Width)
+			}
+		}
+		res.Figures = append(res.Figures, fig)
+	}
+	ids := map[string]bool{}
+	for i, sj := range js.Shapes {
+		sh := Shape{ID: sj.ID, Kind: sj.Kind, RX: sj.RX, RY: sj.RY, StrokeWidth: sj.Width, Text: sj.Text, Size: sj.Size, Align: sj.Align, Asset: sj.Asset, W: sj.W, H: sj.H, Opacity: sj.Opacity, Blend: sj.Blend}
+		for _, p := range sj.Points {
+			sh.Points = append(sh.Points, image.Pt(p.X, p.Y))
+		}
+		if sj.Fill != "" {
+			if sh.Fill, err = parseColor(sj.Fill); err != nil {
+				return fmt.Errorf("shape %d: fill: %w", i, err)
+			}
+		}
+		if sj.Stroke != "" {
+			if sh.Stroke, err = parseColor(sj.Stroke); err != nil {
+				return fmt.Errorf("shape %d: stroke: %w", i, err)
+			}
+		}
+		if err := sh.Check(); err != nil {
+			return fmt.Errorf("shape %d: %w", i, err)
+		}
+		if sh.ID == "" || ids[sh.ID] {
+			return fmt.Errorf("shape %d: missing or repeated id %q", i, sh.ID)
+		}
+		ids[sh.ID] = true
+		res.Shapes = append(res.Shapes, sh)
+	}
+	*s = res
+	return nil
+}
+
+// Check reports figures and shapes too large for a canvas of the given
+// size, which the parsers reject as well. Decoding a scene cannot check
+// them, as it does not know the canvas.
+func (s Scene) Check(canvas image.Point) error {
+	limit := MaxFigureSize(canvas)
+	for i, f := range s.Figures {
+		if f.Size > limit || f.OutlineWidth > limit {
+			return fmt.Errorf("figure %d: size %d or outline width %d is larger than %d", i, f.Size, f.OutlineWidth, limit)
+		}
+	}
+	for i, sh := range s.Shapes {
+		if err := sh.CheckExtent(canvas); err != nil {
+			return fmt.Errorf("shape %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// formatColor writes c with straight, not premultiplied, alpha, as colours
+// are written in scripts.
+func formatColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
+
+// parseColor reads the #rrggbb and #rrggbbaa forms written by formatColor.
+func parseColor(s string) (color.RGBA, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if !ok || len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	n := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(n).(color.RGBA), nil
+}
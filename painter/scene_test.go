@@ -0,0 +1,129 @@
+package painter
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestScene_JSON(t *testing.T) {
+	rect := image.Rect(200, 200, 600, 600)
+	s := Scene{
+		Background: color.RGBA{255, 255, 255, 255},
+		BgRect:     &rect,
+		Border:     &Border{Thickness: 10, Color: color.RGBA{0, 255, 0, 255}},
+		Figures: []DrawT180{
+			{PosX: 400, PosY: 300, Size: 100, Color: color.RGBA{255, 255, 0, 255}},
+		},
+		Shapes: []Shape{
+			{ID: "sun", Kind: Circle, Points: []image.Point{{700, 100}}, RX: 50, RY: 50, Fill: color.RGBA{255, 255, 0, 255}},
+			{
+				ID: "road", Kind: Polyline, Points: []image.Point{{0, 700}, {400, 650}, {800, 700}},
+				Stroke: color.RGBA{0, 0, 0, 255}, StrokeWidth: 3,
+			},
+		},
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"background":"#ffffffff","bgrect":{"x1":200,"y1":200,"x2":600,"y2":600},` +
+		`"border":{"thickness":10,"color":"#00ff00ff"},` +
+		`"figures":[{"x":400,"y":300,"size":100,"color":"#ffff00ff"}],` +
+		`"shapes":[{"id":"sun","kind":"circle","points":[{"x":700,"y":100}],"rx":50,"ry":50,"fill":"#ffff00ff"},` +
+		`{"id":"road","kind":"polyline","points":[{"x":0,"y":700},{"x":400,"y":650},{"x":800,"y":700}],"stroke":"#000000ff","width":3}]}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+
+	var got Scene
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, s)
+	}
+
+	for _, bad := range []string{
+		`{"background":"green"}`,
+		`{"background":"#fff","shapes":[{"id":"a","kind":"star","points":[{"x":1,"y":1}]}]}`,
+		`{"background":"#fff","shapes":[{"id":"a","kind":"line","points":[{"x":1,"y":1}]}]}`,
+		`{"background":"#fff","shapes":[{"id":"a","kind":"circle","points":[{"x":1,"y":1}],"rx":1,"ry":2}]}`,
+		`{"background":"#fff","shapes":[{"kind":"line","points":[{"x":1,"y":1},{"x":2,"y":2}]}]}`,
+		`{"background":"#ffffff","figures":[{"x":1,"y":1,"size":0,"color":"#ffff00"}]}`,
+		`{"background":"#ffffff","figures":[{"x":1,"y":1,"size":10,"color":"#ffff00","outline":{"width":-1,"color":"#000000"}}]}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &got); err == nil {
+			t.Errorf("Unmarshal() accepted %s", bad)
+		}
+	}
+}
+
+func TestScene_Render(t *testing.T) {
+	s := Scene{
+		Background: color.RGBA{0, 128, 0, 255},
+		Border:     &Border{Thickness: 10, Color: color.RGBA{255, 0, 0, 255}},
+		Figures: []DrawT180{
+			{PosX: 400, PosY: 400, Size: 100, Color: color.RGBA{255, 255, 0, 255}},
+		},
+	}
+	img := s.Render(DefaultSize)
+
+	tests := []struct {
+		p    image.Point
+		want color.RGBA
+	}{
+		{image.Pt(100, 100), s.Background},
+		{image.Pt(5, 400), color.RGBA{255, 0, 0, 255}},
+		{image.Pt(400, 400), color.RGBA{255, 255, 0, 255}},
+		{image.Pt(360, 400), color.RGBA{255, 255, 0, 255}},
+		{image.Pt(400, 440), color.RGBA{0, 128, 0, 255}},
+	}
+	for _, tt := range tests {
+		if got := img.RGBAAt(tt.p.X, tt.p.Y); got != tt.want {
+			t.Errorf("pixel at %v = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestLoop_SceneAndFrame(t *testing.T) {
+	var l Loop
+	l.Receiver = &testReceiver{}
+	events, cancel := l.Subscribe()
+	defer cancel()
+
+	l.Start(mockScreen{})
+	l.Post(Reset{})
+	l.Post(FillBackground{Color: color.RGBA{255, 255, 255, 255}})
+	l.Post(UpdateOp)
+	l.Post(SetScene{Scene: Scene{
+		Background: color.RGBA{0, 0, 255, 255},
+		Figures:    []DrawT180{{PosX: 10, PosY: 10, Size: 10, Color: color.RGBA{255, 0, 0, 255}}},
+	}})
+	l.StopAndWait()
+
+	if s := l.Scene(); s.Background != (color.RGBA{0, 0, 255, 255}) || len(s.Figures) != 1 {
+		t.Errorf("Scene() = %+v, want the scene set by SetScene", s)
+	}
+
+	// The initial frame presented by Start and the one update.
+	img, seq := l.Frame()
+	if seq != 2 {
+		t.Errorf("frame seq = %d, want 2", seq)
+	}
+	if got := img.RGBAAt(400, 400); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("frame shows %v, want the white background of the last update", got)
+	}
+
+	var ops []string
+	for len(events) > 0 {
+		ops = append(ops, (<-events).Op)
+	}
+	want := []string{"Reset", "FillBackground", "updateOp", "SetScene"}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("events = %v, want %v", ops, want)
+	}
+}
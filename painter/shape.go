@@ -0,0 +1,286 @@
+package painter
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/roman-mazur/architecture-lab-3/painter/geom"
+	"golang.org/x/exp/shiny/screen"
+)
+
+// ShapeKind is the kind of a Shape.
+type ShapeKind string
+
+const (
+	Circle   ShapeKind = "circle"
+	Ellipse  ShapeKind = "ellipse"
+	Line     ShapeKind = "line"
+	Polyline ShapeKind = "polyline"
+	Polygon  ShapeKind = "polygon"
+	Text     ShapeKind = "text"
+	Sprite   ShapeKind = "sprite"
+)
+
+// Shape is a primitive drawn over the figures. Shapes are told apart by
+// their IDs.
+type Shape struct {
+	ID   string
+	Kind ShapeKind
+	// Points holds the centre of a circle or an ellipse, the anchor of a
+	// text and the vertices of the other kinds. The first point is the one
+	// Move puts at its position.
+	Points []image.Point
+	// RX and RY are the radii of circles and ellipses; a circle has them
+	// equal.
+	RX, RY int
+	// Fill is skipped if transparent. Lines and polylines are not filled.
+	Fill color.RGBA
+	// StrokeWidth pixels wide Stroke is drawn along the shape if the width
+	// is positive.
+	Stroke      color.RGBA
+	StrokeWidth int
+	// Text is drawn with Fill, Size pixels high and aligned by Align to its
+	// anchor, which is on the baseline of the first line.
+	Text  string
+	Size  int
+	Align Align
+	// Asset names the image of a sprite, drawn with its top left corner at
+	// the first point and scaled to W by H pixels, or unscaled if they are
+	// zero.
+	Asset string
+	W, H  int
+	// Opacity fades the shape, from 0 to 1; zero stands for 1. Blend is how
+	// the shape mixes with what is under it.
+	Opacity float64
+	Blend   Blend
+}
+
+// hitWidth is the width thin strokes get for hit-testing.
+const hitWidth = 6
+
+// MaxExtent returns how far from the origin the points of shapes may be on
+// a canvas of the given size, and how large their radii and stroke widths
+// may be. Shapes reaching further would take seconds to render.
+func MaxExtent(canvas image.Point) int {
+	return MaxScale * max(canvas.X, canvas.Y)
+}
+
+// CheckExtent reports shapes reaching further than MaxExtent on a canvas of
+// the given size, texts higher than the canvas and sprites more than
+// MaxScale times larger than it.
+func (s Shape) CheckExtent(canvas image.Point) error {
+	limit := MaxExtent(canvas)
+	for _, p := range s.Points {
+		if p.X < -limit || p.X > limit || p.Y < -limit || p.Y > limit {
+			return fmt.Errorf("point %v is further than %d from the origin", p, limit)
+		}
+	}
+	if s.RX > limit || s.RY > limit {
+		return fmt.Errorf("radii %d and %d are larger than %d", s.RX, s.RY, limit)
+	}
+	if s.StrokeWidth > limit {
+		return fmt.Errorf("stroke width %d is larger than %d", s.StrokeWidth, limit)
+	}
+	if s.Kind == Text && s.Size > canvas.Y {
+		return fmt.Errorf("text size %d is larger than the canvas height %d", s.Size, canvas.Y)
+	}
+	if big := canvas.Mul(MaxScale); s.Kind == Sprite && (s.W > big.X || s.H > big.Y) {
+		return fmt.Errorf("sprite size %dx%d is larger than %dx%d", s.W, s.H, big.X, big.Y)
+	}
+	return nil
+}
+
+// Check reports shapes that cannot be drawn: unknown kinds and wrong
+// numbers of points or radii.
+func (s Shape) Check() error {
+	switch s.Kind {
+	case Circle, Ellipse:
+		if len(s.Points) != 1 {
+			return fmt.Errorf("%s needs 1 point, got %d", s.Kind, len(s.Points))
+		}
+		if s.RX <= 0 || s.RY <= 0 || s.Kind == Circle && s.RX != s.RY {
+			return fmt.Errorf("bad %s radii %d and %d", s.Kind, s.RX, s.RY)
+		}
+	case Line:
+		if len(s.Points) != 2 {
+			return fmt.Errorf("line needs 2 points, got %d", len(s.Points))
+		}
+	case Polyline, Polygon:
+		if n := map[ShapeKind]int{Polyline: 2, Polygon: 3}[s.Kind]; len(s.Points) < n {
+			return fmt.Errorf("%s needs at least %d points, got %d", s.Kind, n, len(s.Points))
+		}
+	case Text:
+		if len(s.Points) != 1 {
+			return fmt.Errorf("text needs 1 point, got %d", len(s.Points))
+		}
+		if s.Text == "" || s.Size <= 0 {
+			return errors.New("text needs a string and a positive size")
+		}
+		if _, ok := alignShift[s.Align]; !ok {
+			return fmt.Errorf("unknown alignment %q", s.Align)
+		}
+	case Sprite:
+		if len(s.Points) != 1 {
+			return fmt.Errorf("sprite needs 1 point, got %d", len(s.Points))
+		}
+		if !assetName.MatchString(s.Asset) {
+			return fmt.Errorf("%w: %q", ErrAssetName, s.Asset)
+		}
+		if s.W < 0 || s.H < 0 || (s.W == 0) != (s.H == 0) {
+			return fmt.Errorf("bad sprite size %dx%d", s.W, s.H)
+		}
+	default:
+		return fmt.Errorf("unknown shape kind %q", s.Kind)
+	}
+	if s.StrokeWidth < 0 {
+		return errors.New("stroke width must not be negative")
+	}
+	if s.Opacity != 0 {
+		if err := CheckOpacity(s.Opacity); err != nil {
+			return err
+		}
+	}
+	if err := CheckBlend(s.Blend); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s Shape) closed() bool {
+	return s.Kind != Line && s.Kind != Polyline
+}
+
+// path returns the outline of a closed shape or the points of an open one.
+func (s Shape) path() []geom.Point {
+	if len(s.Points) == 0 {
+		return nil
+	}
+	if s.Kind == Circle || s.Kind == Ellipse {
+		c := s.Points[0]
+		return geom.Ellipse(geom.Point{X: float64(c.X), Y: float64(c.Y)}, float64(s.RX), float64(s.RY))
+	}
+	res := make([]geom.Point, len(s.Points))
+	for i, p := range s.Points {
+		res[i] = geom.Point{X: float64(p.X), Y: float64(p.Y)}
+	}
+	return res
+}
+
+// polygons returns what is filled with Fill and with Stroke, if anything.
+func (s Shape) polygons() (fill, stroke [][]geom.Point) {
+	path := s.path()
+	if s.closed() && s.Fill.A > 0 {
+		fill = [][]geom.Point{path}
+	}
+	if s.StrokeWidth > 0 {
+		stroke = geom.StrokePath(path, s.closed(), float64(s.StrokeWidth), geom.JoinMiter, geom.CapButt)
+	}
+	return fill, stroke
+}
+
+func (s Shape) render(r *renderer) {
+	switch s.Kind {
+	case Text:
+		if mask := s.textMask(r.img.Bounds()); mask != nil {
+			r.mask(mask.Rect, mask, s.Fill)
+		}
+		return
+	case Sprite:
+		if img, ok := r.assets.Get(s.Asset); ok {
+			r.image(s.spriteRect(img.Rect.Size()), img)
+		}
+		return
+	}
+	fill, stroke := s.polygons()
+	r.fill(fill, s.Fill)
+	r.fill(stroke, s.Stroke)
+}
+
+func (s Shape) style() style {
+	return style{s.Opacity, s.Blend}
+}
+
+// draw fills the shape on t. Textures cannot draw images, so sprites are
+// left out.
+func (s Shape) draw(t filler) {
+	switch s.Kind {
+	case Text:
+		if mask := s.textMask(t.Bounds()); mask != nil {
+			fillMask(t, mask, s.style().fade(s.Fill))
+		}
+		return
+	case Sprite:
+		return
+	}
+	fill, stroke := s.polygons()
+	fillPolygons(t, fill, s.style().fade(s.Fill))
+	fillPolygons(t, stroke, s.style().fade(s.Stroke))
+}
+
+// Bounds returns the pixels the shape may touch.
+func (s Shape) Bounds() image.Rectangle {
+	switch s.Kind {
+	case Text:
+		return s.textBounds()
+	case Sprite:
+		return s.spriteRect(image.Point{})
+	}
+	fill, stroke := s.polygons()
+	return polyBounds(append(fill, stroke...))
+}
+
+// Contains reports whether the pixel p is on the shape. Closed shapes count
+// as filled, strokes are at least hitWidth wide and texts and sprites are
+// picked by their bounds, so that thin and hollow shapes can still be
+// picked.
+func (s Shape) Contains(p image.Point) bool {
+	if s.Kind == Text || s.Kind == Sprite {
+		return p.In(s.Bounds())
+	}
+	c := geom.Point{X: float64(p.X) + 0.5, Y: float64(p.Y) + 0.5}
+	path := s.path()
+	if s.closed() && geom.Inside([][]geom.Point{path}, c) {
+		return true
+	}
+	w := float64(max(s.StrokeWidth, hitWidth))
+	return geom.Inside(geom.StrokePath(path, s.closed(), w, geom.JoinRound, geom.CapRound), c)
+}
+
+// moved returns a copy of the shape moved by d.
+func (s Shape) moved(d image.Point) Shape {
+	pts := make([]image.Point, len(s.Points))
+	for i, p := range s.Points {
+		pts[i] = p.Add(d)
+	}
+	s.Points = pts
+	return s
+}
+
+func (s Shape) clone() Shape {
+	s.Points = append([]image.Point(nil), s.Points...)
+	return s
+}
+
+// DrawShape adds Shape to the scene. It replaces the shape with the same ID,
+// if there is one; a shape without an ID gets a new one.
+type DrawShape struct {
+	Shape Shape
+}
+
+func (op DrawShape) Do(t screen.Texture) bool {
+	op.Shape.draw(t)
+	return false
+}
+
+// MoveShape moves the shape with the given ID by By. Missing shapes are
+// left alone.
+type MoveShape struct {
+	ID string
+	By image.Point
+}
+
+func (MoveShape) Do(t screen.Texture) bool {
+	return false
+}
@@ -0,0 +1,114 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestLoop_Shapes(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	var l Loop
+	l.Start(nil)
+	l.Post(Reset{})
+	l.Post(DrawShape{Shape{Kind: Circle, Points: []image.Point{{100, 100}}, RX: 20, RY: 20, Fill: red}})
+	l.Post(DrawShape{Shape{Kind: Circle, Points: []image.Point{{300, 300}}, RX: 20, RY: 20, Fill: red}})
+	l.Post(DrawShape{Shape{ID: "l", Kind: Line, Points: []image.Point{{0, 0}, {10, 0}}, Stroke: red, StrokeWidth: 1}})
+	// The same ID replaces the line.
+	l.Post(DrawShape{Shape{ID: "l", Kind: Line, Points: []image.Point{{0, 500}, {100, 500}}, Stroke: red, StrokeWidth: 1}})
+	l.Post(MoveShape{ID: "circle-2", By: image.Pt(10, -10)})
+	l.Post(MoveShape{ID: "missing", By: image.Pt(10, -10)})
+	l.StopAndWait()
+
+	shapes := l.Scene().Shapes
+	if len(shapes) != 3 || shapes[0].ID != "circle-1" || shapes[1].ID != "circle-2" || shapes[2].ID != "l" {
+		t.Fatalf("shapes = %+v, want circle-1, circle-2 and l", shapes)
+	}
+	if got := shapes[1].Points[0]; got != image.Pt(310, 290) {
+		t.Errorf("moved circle at %v, want (310, 290)", got)
+	}
+
+	for _, tt := range []struct {
+		p    image.Point
+		want string
+	}{
+		{image.Pt(100, 100), "circle-1"},
+		{image.Pt(310, 275), "circle-2"},
+		// Thin lines are easier to hit than they look.
+		{image.Pt(50, 502), "l"},
+		{image.Pt(50, 510), ""},
+		{image.Pt(335, 300), ""},
+	} {
+		if got, _ := l.ShapeAt(tt.p); got != tt.want {
+			t.Errorf("ShapeAt(%v) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestLoop_MoveMovesShapes(t *testing.T) {
+	var l Loop
+	l.Start(nil)
+	l.Post(Reset{})
+	l.Post(DrawShape{Shape{Kind: Polygon, Points: []image.Point{{10, 10}, {30, 10}, {20, 30}}}})
+	l.Post(Move{NewPos: image.Pt(100, 200)})
+	l.StopAndWait()
+
+	want := []image.Point{{100, 200}, {120, 200}, {110, 220}}
+	got := l.Scene().Shapes[0].Points
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("moved polygon = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestShape_Render(t *testing.T) {
+	bg := color.RGBA{0, 128, 0, 255}
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	s := Scene{Background: bg, Shapes: []Shape{
+		{ID: "e", Kind: Ellipse, Points: []image.Point{{100, 100}}, RX: 60, RY: 20, Fill: red, Stroke: blue, StrokeWidth: 4},
+		{ID: "p", Kind: Polyline, Points: []image.Point{{200, 10}, {300, 10}, {300, 110}}, Stroke: blue, StrokeWidth: 4},
+		{ID: "g", Kind: Polygon, Points: []image.Point{{400, 10}, {500, 10}, {450, 110}}, Fill: red},
+	}}
+	img := s.Render(image.Pt(600, 200))
+
+	for _, tt := range []struct {
+		name string
+		p    image.Point
+		want color.RGBA
+	}{
+		{"ellipse inside", image.Pt(150, 100), red},
+		{"ellipse stroke", image.Pt(160, 100), blue},
+		{"ellipse outside", image.Pt(100, 125), bg},
+		{"polyline", image.Pt(250, 10), blue},
+		{"polyline corner", image.Pt(301, 9), blue},
+		{"polyline is not filled", image.Pt(290, 20), bg},
+		{"polygon", image.Pt(450, 40), red},
+		{"polygon outside", image.Pt(410, 100), bg},
+	} {
+		if got := img.RGBAAt(tt.p.X, tt.p.Y); got != tt.want {
+			t.Errorf("%s: pixel at %v = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestShape_CheckExtent(t *testing.T) {
+	canvas := image.Pt(800, 600)
+	for _, tt := range []struct {
+		sh Shape
+		ok bool
+	}{
+		{Shape{Kind: Circle, Points: []image.Point{{400, 300}}, RX: 3200, RY: 3200}, true},
+		{Shape{Kind: Circle, Points: []image.Point{{400, 300}}, RX: 2000000000, RY: 2000000000}, false},
+		{Shape{Kind: Polygon, Points: []image.Point{{0, 0}, {-3200, 0}, {0, 3201}}}, false},
+		{Shape{Kind: Line, Points: []image.Point{{0, 0}, {10, 10}}, StrokeWidth: 5000}, false},
+		{Shape{Kind: Text, Points: []image.Point{{0, 100}}, Text: "a", Size: 600}, true},
+		{Shape{Kind: Text, Points: []image.Point{{0, 100}}, Text: "a", Size: 1000000}, false},
+		{Shape{Kind: Sprite, Points: []image.Point{{0, 0}}, Asset: "logo", W: 3200, H: 2400}, true},
+		{Shape{Kind: Sprite, Points: []image.Point{{0, 0}}, Asset: "logo", W: 200000, H: 200000}, false},
+	} {
+		if err := tt.sh.CheckExtent(canvas); (err == nil) != tt.ok {
+			t.Errorf("CheckExtent(%+v) = %v, want ok %t", tt.sh, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package painter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/shiny/screen"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Align places text horizontally relative to its anchor.
+type Align string
+
+const (
+	AlignLeft   Align = "left"
+	AlignCenter Align = "center"
+	AlignRight  Align = "right"
+)
+
+// alignShift is how many halves of the line width go left of the anchor.
+// The empty alignment is the same as AlignLeft.
+var alignShift = map[Align]int{"": 0, AlignLeft: 0, AlignCenter: 1, AlignRight: 2}
+
+// DefaultTextSize is the height of basicfont glyphs, which are drawn
+// unscaled at this size.
+const DefaultTextSize = 13
+
+var textFont struct {
+	sync.Mutex
+	f *opentype.Font
+}
+
+// LoadFont makes texts use the OpenType or TrueType font in the file at
+// path instead of basicfont.
+func LoadFont(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return setFont(data)
+}
+
+// setFont parses data as a font for texts; nil brings basicfont back.
+func setFont(data []byte) error {
+	var f *opentype.Font
+	if data != nil {
+		var err error
+		if f, err = opentype.Parse(data); err != nil {
+			return fmt.Errorf("cannot parse font: %w", err)
+		}
+	}
+	textFont.Lock()
+	textFont.f = f
+	textFont.Unlock()
+	return nil
+}
+
+// textFace returns the face to draw text of the given size with and the
+// scale to enlarge it by. basicfont has a single size, so it is scaled by
+// whole pixels. Faces keep state while drawing, so each text gets its own.
+func textFace(size int) (font.Face, int) {
+	textFont.Lock()
+	f := textFont.f
+	textFont.Unlock()
+	if f != nil {
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: float64(size), DPI: 72, Hinting: font.HintingFull})
+		if err == nil {
+			return face, 1
+		}
+	}
+	return basicfont.Face7x13, max(1, (size+DefaultTextSize/2)/DefaultTextSize)
+}
+
+// textLayout measures the lines of s in unscaled face pixels: the width of
+// each line, the line height and the ascent.
+func (s Shape) textLayout(face font.Face) (lines []string, widths []int, height, ascent int) {
+	m := face.Metrics()
+	lines = strings.Split(s.Text, "\n")
+	for _, l := range lines {
+		widths = append(widths, font.MeasureString(face, l).Ceil())
+	}
+	return lines, widths, m.Height.Ceil(), m.Ascent.Ceil()
+}
+
+// textBounds returns the pixels the text may touch.
+func (s Shape) textBounds() image.Rectangle {
+	face, scale := textFace(s.Size)
+	defer face.Close()
+	_, widths, height, ascent := s.textLayout(face)
+	return s.textRect(widths, height, ascent, scale)
+}
+
+func (s Shape) textRect(widths []int, height, ascent, scale int) image.Rectangle {
+	w := 0
+	for _, lw := range widths {
+		w = max(w, lw)
+	}
+	size := image.Pt(w, len(widths)*height).Mul(scale)
+	tl := s.Points[0].Sub(image.Pt(size.X*alignShift[s.Align]/2, ascent*scale))
+	return image.Rectangle{Min: tl, Max: tl.Add(size)}
+}
+
+// textMask returns the coverage of the part of the text inside clip, in
+// canvas coordinates, or nil if none of it is. Only that part is drawn, so
+// that big texts do not take memory for pixels off the canvas.
+func (s Shape) textMask(clip image.Rectangle) *image.Alpha {
+	face, scale := textFace(s.Size)
+	defer face.Close()
+	lines, widths, height, ascent := s.textLayout(face)
+	at := s.textRect(widths, height, ascent, scale)
+	visible := at.Intersect(clip)
+	if visible.Empty() {
+		return nil
+	}
+
+	// Glyphs are drawn unscaled, in coordinates relative to the text.
+	vr := visible.Sub(at.Min)
+	unscaled := image.Rect(vr.Min.X/scale, vr.Min.Y/scale, (vr.Max.X+scale-1)/scale, (vr.Max.Y+scale-1)/scale)
+	mask := image.NewAlpha(unscaled)
+	d := font.Drawer{Dst: mask, Src: image.Opaque, Face: face}
+	for i, l := range lines {
+		x := (at.Dx()/scale - widths[i]) * alignShift[s.Align] / 2
+		d.Dot = fixed.P(x, ascent+i*height)
+		d.DrawString(l)
+	}
+	if scale == 1 {
+		mask.Rect = mask.Rect.Add(at.Min)
+		return mask
+	}
+	big := image.NewAlpha(visible)
+	dr := image.Rectangle{Min: unscaled.Min.Mul(scale), Max: unscaled.Max.Mul(scale)}.Add(at.Min)
+	xdraw.NearestNeighbor.Scale(big, dr, mask, unscaled, xdraw.Src, nil)
+	return big
+}
+
+// fillMask paints c over the pixels at which mask is at least half opaque.
+// Textures can only fill rectangles, so each run of such pixels in a row is
+// filled separately.
+func fillMask(t filler, mask *image.Alpha, c color.Color) {
+	r := mask.Rect
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		start := -1
+		for x := r.Min.X; x <= r.Max.X; x++ {
+			on := x < r.Max.X && mask.AlphaAt(x, y).A >= 0x80
+			switch {
+			case on && start < 0:
+				start = x
+			case !on && start >= 0:
+				t.Fill(image.Rect(start, y, x, y+1), c, screen.Over)
+				start = -1
+			}
+		}
+	}
+}
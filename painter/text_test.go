@@ -0,0 +1,115 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestShape_Text(t *testing.T) {
+	text := func(align Align, size int) Shape {
+		return Shape{ID: "t", Kind: Text, Points: []image.Point{{100, 100}}, Text: "Hi", Size: size, Align: align, Fill: color.RGBA{255, 0, 0, 255}}
+	}
+
+	// basicfont glyphs are 7 pixels wide with 11 pixels above the baseline.
+	for _, tt := range []struct {
+		sh   Shape
+		want image.Rectangle
+	}{
+		{text("", DefaultTextSize), image.Rect(100, 89, 114, 102)},
+		{text(AlignCenter, DefaultTextSize), image.Rect(93, 89, 107, 102)},
+		{text(AlignRight, DefaultTextSize), image.Rect(86, 89, 100, 102)},
+		{text("", 2*DefaultTextSize), image.Rect(100, 78, 128, 104)},
+	} {
+		if got := tt.sh.Bounds(); got != tt.want {
+			t.Errorf("Bounds() of %q text of size %d = %v, want %v", tt.sh.Align, tt.sh.Size, got, tt.want)
+		}
+	}
+
+	sh := text(AlignCenter, 2*DefaultTextSize)
+	for _, two := range []bool{false, true} {
+		sh.Text = "Hi"
+		if two {
+			// A second line makes the text taller but not wider.
+			sh.Text = "Hi\nH"
+		}
+		s := Scene{Background: color.RGBA{0, 0, 0, 255}, Shapes: []Shape{sh}}
+		img := s.Render(image.Pt(200, 200))
+		var painted image.Rectangle
+		for y := range 200 {
+			for x := range 200 {
+				if img.RGBAAt(x, y) == sh.Fill {
+					painted = painted.Union(image.Rect(x, y, x+1, y+1))
+				}
+			}
+		}
+		if b := sh.Bounds(); painted.Empty() || !painted.In(b) {
+			t.Errorf("%q painted %v, want within %v", sh.Text, painted, b)
+		}
+		if got, want := painted.Dy() > 2*DefaultTextSize, two; got != want {
+			t.Errorf("%q painted %d rows", sh.Text, painted.Dy())
+		}
+		if b := sh.Bounds(); !sh.Contains(b.Min) || sh.Contains(b.Min.Sub(image.Pt(1, 1))) {
+			t.Errorf("Contains() does not match the bounds %v", sh.Bounds())
+		}
+	}
+}
+
+func TestShape_TextWithFont(t *testing.T) {
+	if err := setFont(goregular.TTF); err != nil {
+		t.Fatal(err)
+	}
+	defer setFont(nil)
+
+	sh := Shape{Kind: Text, Points: []image.Point{{100, 100}}, Text: "Hello", Size: 40}
+	b := sh.Bounds()
+	// The line height of Go Regular is a little over its size.
+	if b.Dy() < 40 || b.Dy() > 50 || b.Dx() < 60 || b.Max.Y <= 100 || b.Min.X != 100 {
+		t.Errorf("Bounds() = %v, want a 40 pixel line starting at (100, 100)", b)
+	}
+	if err := setFont([]byte("not a font")); err == nil {
+		t.Error("setFont() accepted a broken font")
+	}
+}
+
+func TestLoop_MovesText(t *testing.T) {
+	var l Loop
+	l.Start(nil)
+	l.Post(Reset{})
+	l.Post(DrawShape{Shape{ID: "label", Kind: Text, Points: []image.Point{{10, 20}}, Text: "label", Size: DefaultTextSize}})
+	l.Post(MoveShape{ID: "label", By: image.Pt(5, 5)})
+	l.StopAndWait()
+
+	sh := l.Scene().Shapes[0]
+	if sh.Points[0] != image.Pt(15, 25) {
+		t.Errorf("text at %v, want (15, 25)", sh.Points[0])
+	}
+	if got, _ := l.ShapeAt(image.Pt(20, 20)); got != "label" {
+		t.Errorf("ShapeAt() = %q, want label", got)
+	}
+}
+
+func TestShape_TextIsClipped(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	// Half of the text is off the canvas, above and to the left.
+	sh := Shape{Kind: Text, Points: []image.Point{{-20, 5}}, Text: "HiHi", Size: 2 * DefaultTextSize, Fill: red}
+	small := (&Scene{Shapes: []Shape{sh}}).Render(image.Pt(40, 20))
+
+	shifted := sh.moved(image.Pt(100, 100))
+	big := (&Scene{Shapes: []Shape{shifted}}).Render(image.Pt(200, 200))
+	for y := range 20 {
+		for x := range 40 {
+			if got, want := small.RGBAAt(x, y), big.RGBAAt(x+100, y+100); got != want {
+				t.Fatalf("pixel (%d, %d) = %v, want %v as when not clipped", x, y, got, want)
+			}
+		}
+	}
+
+	// Texts much larger than the canvas only take memory for what is on it.
+	huge := Shape{Kind: Text, Points: []image.Point{{0, 4000000}}, Text: "H", Size: 5000000, Fill: red}
+	if mask := huge.textMask(image.Rect(0, 0, 10, 10)); mask == nil || mask.Rect != image.Rect(0, 0, 10, 10) {
+		t.Errorf("mask of a huge text = %v, want the 10x10 canvas", mask)
+	}
+}
@@ -0,0 +1,50 @@
+package painter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/exp/shiny/screen"
+)
+
+// memTexture is a screen.Texture kept in memory. It lets a Loop run without
+// a window, e.g. for canvases that are not shown on screen.
+type memTexture struct {
+	img *image.RGBA
+}
+
+func newMemTexture(size image.Point) *memTexture {
+	return &memTexture{img: image.NewRGBA(image.Rectangle{Max: size})}
+}
+
+func (t *memTexture) Release() {}
+
+func (t *memTexture) Size() image.Point { return t.img.Bounds().Size() }
+
+func (t *memTexture) Bounds() image.Rectangle { return t.img.Bounds() }
+
+func (t *memTexture) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {
+	draw.Draw(t.img, sr.Sub(sr.Min).Add(dp), src.RGBA(), sr.Min, draw.Src)
+}
+
+func (t *memTexture) Fill(dr image.Rectangle, src color.Color, op draw.Op) {
+	draw.Draw(t.img, dr, image.NewUniform(src), image.Point{}, op)
+}
+
+// memBuffer is a screen.Buffer for memTexture.
+type memBuffer struct {
+	img *image.RGBA
+}
+
+func newMemBuffer(size image.Point) *memBuffer {
+	return &memBuffer{img: image.NewRGBA(image.Rectangle{Max: size})}
+}
+
+func (b *memBuffer) Release() {}
+
+func (b *memBuffer) Size() image.Point { return b.img.Bounds().Size() }
+
+func (b *memBuffer) Bounds() image.Rectangle { return b.img.Bounds() }
+
+func (b *memBuffer) RGBA() *image.RGBA { return b.img }
@@ -0,0 +1,128 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// HUDStats is the state of the shown canvas displayed by the debug overlay.
+type HUDStats struct {
+	FrameSeq uint64
+	// Queued is the number of operations waiting to be handled.
+	Queued  int
+	Figures int
+	LastOp  string
+}
+
+// fpsCounter counts the frames received in the last second.
+type fpsCounter struct {
+	frames []time.Time
+}
+
+func (c *fpsCounter) add(now time.Time) {
+	c.frames = append(c.frames, now)
+	c.trim(now)
+}
+
+func (c *fpsCounter) rate(now time.Time) int {
+	c.trim(now)
+	return len(c.frames)
+}
+
+func (c *fpsCounter) trim(now time.Time) {
+	i := 0
+	for i < len(c.frames) && now.Sub(c.frames[i]) >= time.Second {
+		i++
+	}
+	c.frames = c.frames[i:]
+}
+
+// hudLines formats the debug overlay. mouse is nil while the pointer is
+// outside of the canvas.
+func hudLines(fps int, st HUDStats, mouse *image.Point) []string {
+	pos := "-"
+	if mouse != nil {
+		pos = fmt.Sprintf("%d, %d", mouse.X, mouse.Y)
+	}
+	lastOp := st.LastOp
+	if lastOp == "" {
+		lastOp = "-"
+	}
+	return []string{
+		fmt.Sprintf("FPS      %d", fps),
+		fmt.Sprintf("frame    %d", st.FrameSeq),
+		fmt.Sprintf("queue    %d", st.Queued),
+		fmt.Sprintf("figures  %d", st.Figures),
+		fmt.Sprintf("last op  %s", lastOp),
+		fmt.Sprintf("mouse    %s", pos),
+	}
+}
+
+// gridSteps are the spacings of the pixel grid in canvas pixels.
+var gridSteps = []int{1, 2, 5, 10, 20, 50, 100, 200, 500}
+
+// minGridGap is the smallest gap between grid lines in window pixels.
+const minGridGap = 8
+
+// gridStep returns the smallest grid spacing whose lines are at least
+// minGridGap window pixels apart when a canvas pixel is scale window
+// pixels wide.
+func gridStep(scale float64) int {
+	for _, s := range gridSteps {
+		if float64(s)*scale >= minGridGap {
+			return s
+		}
+	}
+	return gridSteps[len(gridSteps)-1]
+}
+
+var (
+	gridColor      = color.RGBA{0, 0, 0, 48}
+	gridMajorColor = color.RGBA{0, 0, 0, 112}
+)
+
+// drawGrid draws lines between canvas pixels, every tenth line darker.
+func (v *Visualizer) drawGrid(vp viewport) {
+	if !vp.ok() {
+		return
+	}
+	step := gridStep(float64(vp.Rect.Dx()) / float64(vp.Canvas.X))
+	line := func(r image.Rectangle, i int) {
+		c := gridColor
+		if (i/step)%10 == 0 {
+			c = gridMajorColor
+		}
+		v.w.Fill(r, c, draw.Over)
+	}
+	for x := 0; x <= vp.Canvas.X; x += step {
+		wx := vp.fromCanvas(image.Rect(x, 0, x, 0)).Min.X
+		line(image.Rect(wx, vp.Rect.Min.Y, wx+1, vp.Rect.Max.Y), x)
+	}
+	for y := 0; y <= vp.Canvas.Y; y += step {
+		wy := vp.fromCanvas(image.Rect(0, y, 0, y)).Min.Y
+		line(image.Rect(vp.Rect.Min.X, wy, vp.Rect.Max.X, wy+1), y)
+	}
+}
+
+// drawHUD draws the grid and the debug text over the bottom left corner of
+// the canvas.
+func (v *Visualizer) drawHUD(vp viewport) {
+	v.drawGrid(vp)
+
+	var st HUDStats
+	if v.Stats != nil {
+		st = v.Stats()
+	}
+	var mouse *image.Point
+	if v.mouseIn {
+		mouse = &v.mouse
+	}
+	lines := hudLines(v.fps.rate(time.Now()), st, mouse)
+	size := panelSize(lines)
+	at := image.Pt(vp.Rect.Min.X, vp.Rect.Max.Y).Add(image.Pt(panelPad, -panelPad-size.Y).Mul(vp.Scale))
+	v.drawPanel(vp, at, lines)
+}
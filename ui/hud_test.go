@@ -0,0 +1,55 @@
+package ui
+
+import (
+	"image"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFPSCounter(t *testing.T) {
+	var c fpsCounter
+	start := time.Unix(0, 0)
+	for i := range 30 {
+		c.add(start.Add(time.Duration(i) * 50 * time.Millisecond))
+	}
+	// Frames from 0.5s to 1.45s are within the last second at 1.45s.
+	if got := c.rate(start.Add(1450 * time.Millisecond)); got != 20 {
+		t.Errorf("rate() = %d, want 20", got)
+	}
+	if got := c.rate(start.Add(10 * time.Second)); got != 0 {
+		t.Errorf("rate() after a pause = %d, want 0", got)
+	}
+}
+
+func TestHUDLines(t *testing.T) {
+	st := HUDStats{FrameSeq: 42, Queued: 3, Figures: 7, LastOp: "MoveFigure"}
+	got := hudLines(60, st, &image.Point{10, 20})
+	want := []string{
+		"FPS      60",
+		"frame    42",
+		"queue    3",
+		"figures  7",
+		"last op  MoveFigure",
+		"mouse    10, 20",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hudLines() = %q, want %q", got, want)
+	}
+	if got := hudLines(0, HUDStats{}, nil); got[4] != "last op  -" || got[5] != "mouse    -" {
+		t.Errorf("hudLines() without data = %q", got)
+	}
+}
+
+func TestGridStep(t *testing.T) {
+	for _, tt := range []struct {
+		scale float64
+		want  int
+	}{
+		{16, 1}, {8, 1}, {4, 2}, {1, 10}, {0.5, 20}, {0.01, 500},
+	} {
+		if got := gridStep(tt.scale); got != tt.want {
+			t.Errorf("gridStep(%v) = %d, want %d", tt.scale, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package ui
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mobile/event/key"
+)
+
+// Action is something the user can do from the keyboard.
+type Action string
+
+const (
+	NudgeLeft       Action = "nudge-left"
+	NudgeRight      Action = "nudge-right"
+	NudgeUp         Action = "nudge-up"
+	NudgeDown       Action = "nudge-down"
+	Reset           Action = "reset"
+	Update          Action = "update"
+	Screenshot      Action = "screenshot"
+	CycleBackground Action = "cycle-background"
+	NextCanvas      Action = "next-canvas"
+	PrevCanvas      Action = "prev-canvas"
+	Help            Action = "help"
+	ToggleDebug     Action = "debug"
+)
+
+// Nudge steps in pixels; Shift with a nudge key uses the big one.
+const (
+	NudgeStep    = 5
+	BigNudgeStep = 50
+)
+
+// Key is a key press with the modifiers held.
+type Key struct {
+	Code      key.Code
+	Modifiers key.Modifiers
+}
+
+// Keymap binds keys to actions.
+type Keymap map[Key]Action
+
+// DefaultKeymap returns the bindings used by a Visualizer without Keys.
+func DefaultKeymap() Keymap {
+	return Keymap{
+		{Code: key.CodeLeftArrow}:                      NudgeLeft,
+		{Code: key.CodeRightArrow}:                     NudgeRight,
+		{Code: key.CodeUpArrow}:                        NudgeUp,
+		{Code: key.CodeDownArrow}:                      NudgeDown,
+		{Code: key.CodeR}:                              Reset,
+		{Code: key.CodeU}:                              Update,
+		{Code: key.CodeS, Modifiers: key.ModControl}:   Screenshot,
+		{Code: key.CodeB}:                              CycleBackground,
+		{Code: key.CodeTab}:                            NextCanvas,
+		{Code: key.CodeTab, Modifiers: key.ModShift}:   PrevCanvas,
+		{Code: key.CodeSlash, Modifiers: key.ModShift}: Help,
+		{Code: key.CodeF3}:                             ToggleDebug,
+	}
+}
+
+// Bind parses bindings such as "screenshot=ctrl+p,reset=shift+r" and binds
+// the keys, replacing the previous keys of the same actions.
+func (km Keymap) Bind(spec string) error {
+	for _, binding := range strings.Split(spec, ",") {
+		name, keyName, ok := strings.Cut(strings.TrimSpace(binding), "=")
+		if !ok {
+			return fmt.Errorf("binding %q: want action=key", binding)
+		}
+		a := Action(name)
+		if !slices.Contains(actions, a) {
+			return fmt.Errorf("binding %q: unknown action %q", binding, name)
+		}
+		k, err := ParseKey(keyName)
+		if err != nil {
+			return fmt.Errorf("binding %q: %w", binding, err)
+		}
+		for old, action := range km {
+			if action == a {
+				delete(km, old)
+			}
+		}
+		km[k] = a
+	}
+	return nil
+}
+
+// lookup returns the action bound to k. Nudges keep working with Shift
+// held, which makes them bigger.
+func (km Keymap) lookup(k Key) (a Action, big bool, ok bool) {
+	if a, ok := km[k]; ok {
+		return a, false, true
+	}
+	if k.Modifiers&key.ModShift != 0 {
+		k.Modifiers &^= key.ModShift
+		if a, ok := km[k]; ok && strings.HasPrefix(string(a), "nudge-") {
+			return a, true, true
+		}
+	}
+	return "", false, false
+}
+
+// help returns a line per binding, in the order of the actions.
+func (km Keymap) help() []string {
+	keys := slices.Collect(maps.Keys(km))
+	slices.SortFunc(keys, func(a, b Key) int {
+		if c := slices.Index(actions, km[a]) - slices.Index(actions, km[b]); c != 0 {
+			return c
+		}
+		return strings.Compare(a.String(), b.String())
+	})
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		lines[i] = fmt.Sprintf("%-12s %s", k, km[k])
+	}
+	return lines
+}
+
+var actions = []Action{
+	NudgeLeft, NudgeRight, NudgeUp, NudgeDown, Reset, Update, Screenshot,
+	CycleBackground, NextCanvas, PrevCanvas, Help, ToggleDebug,
+}
+
+var keyNames = map[string]key.Code{
+	"left": key.CodeLeftArrow, "right": key.CodeRightArrow,
+	"up": key.CodeUpArrow, "down": key.CodeDownArrow,
+	"tab": key.CodeTab, "space": key.CodeSpacebar, "enter": key.CodeReturnEnter,
+	"backspace": key.CodeDeleteBackspace, "delete": key.CodeDeleteForward,
+	"home": key.CodeHome, "end": key.CodeEnd,
+	"pageup": key.CodePageUp, "pagedown": key.CodePageDown,
+	"/": key.CodeSlash, "-": key.CodeHyphenMinus, "=": key.CodeEqualSign,
+	"[": key.CodeLeftSquareBracket, "]": key.CodeRightSquareBracket,
+	",": key.CodeComma, ".": key.CodeFullStop,
+}
+
+var modifierNames = []struct {
+	name string
+	mod  key.Modifiers
+}{
+	{"ctrl", key.ModControl},
+	{"alt", key.ModAlt},
+	{"meta", key.ModMeta},
+	{"shift", key.ModShift},
+}
+
+// ParseKey reads a key such as "r", "ctrl+s", "shift+left", "f5" or "?",
+// which is Shift with the slash key.
+func ParseKey(s string) (Key, error) {
+	var k Key
+	parts := strings.Split(strings.ToLower(s), "+")
+	name := parts[len(parts)-1]
+parts:
+	for _, m := range parts[:len(parts)-1] {
+		for _, mn := range modifierNames {
+			if mn.name == m {
+				k.Modifiers |= mn.mod
+				continue parts
+			}
+		}
+		return k, fmt.Errorf("unknown modifier %q in key %q", m, s)
+	}
+
+	switch code, ok := keyNames[name]; {
+	case ok:
+		k.Code = code
+	case name == "?":
+		k.Code = key.CodeSlash
+		k.Modifiers |= key.ModShift
+	case len(name) == 1 && name[0] >= 'a' && name[0] <= 'z':
+		k.Code = key.CodeA + key.Code(name[0]-'a')
+	case len(name) == 1 && name[0] >= '1' && name[0] <= '9':
+		k.Code = key.Code1 + key.Code(name[0]-'1')
+	case name == "0":
+		k.Code = key.Code0
+	default:
+		n, err := strconv.Atoi(strings.TrimPrefix(name, "f"))
+		if !strings.HasPrefix(name, "f") || err != nil || n < 1 || n > 12 {
+			return k, fmt.Errorf("unknown key %q", s)
+		}
+		k.Code = key.CodeF1 + key.Code(n-1)
+	}
+	return k, nil
+}
+
+// String formats k the way ParseKey reads it.
+func (k Key) String() string {
+	var b strings.Builder
+	mods := k.Modifiers
+	question := k.Code == key.CodeSlash && mods&key.ModShift != 0
+	if question {
+		mods &^= key.ModShift
+	}
+	for _, mn := range modifierNames {
+		if mods&mn.mod != 0 {
+			b.WriteString(mn.name + "+")
+		}
+	}
+	switch {
+	case question:
+		b.WriteByte('?')
+	case k.Code >= key.CodeA && k.Code <= key.CodeZ:
+		b.WriteByte(byte('a' + k.Code - key.CodeA))
+	case k.Code >= key.Code1 && k.Code <= key.Code9:
+		b.WriteByte(byte('1' + k.Code - key.Code1))
+	case k.Code == key.Code0:
+		b.WriteByte('0')
+	case k.Code >= key.CodeF1 && k.Code <= key.CodeF12:
+		fmt.Fprintf(&b, "f%d", k.Code-key.CodeF1+1)
+	default:
+		for name, code := range keyNames {
+			if code == k.Code {
+				b.WriteString(name)
+				return b.String()
+			}
+		}
+		fmt.Fprintf(&b, "%v", k.Code)
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"testing"
+
+	"golang.org/x/mobile/event/key"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Key
+	}{
+		{"r", Key{Code: key.CodeR}},
+		{"Ctrl+S", Key{Code: key.CodeS, Modifiers: key.ModControl}},
+		{"shift+left", Key{Code: key.CodeLeftArrow, Modifiers: key.ModShift}},
+		{"?", Key{Code: key.CodeSlash, Modifiers: key.ModShift}},
+		{"alt+0", Key{Code: key.Code0, Modifiers: key.ModAlt}},
+		{"f5", Key{Code: key.CodeF5}},
+	}
+	for _, tt := range tests {
+		got, err := ParseKey(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseKey(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+		if back, _ := ParseKey(got.String()); back != got {
+			t.Errorf("%q formats as %q, which parses as %v", tt.in, got.String(), back)
+		}
+	}
+	for _, bad := range []string{"hyper+r", "f13", "enterr", ""} {
+		if _, err := ParseKey(bad); err == nil {
+			t.Errorf("ParseKey(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestKeymap(t *testing.T) {
+	km := DefaultKeymap()
+	if err := km.Bind("screenshot=ctrl+p, reset=shift+r"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		k      Key
+		action Action
+		big    bool
+		ok     bool
+	}{
+		{Key{Code: key.CodeP, Modifiers: key.ModControl}, Screenshot, false, true},
+		{Key{Code: key.CodeS, Modifiers: key.ModControl}, "", false, false},
+		{Key{Code: key.CodeR}, "", false, false},
+		{Key{Code: key.CodeR, Modifiers: key.ModShift}, Reset, false, true},
+		{Key{Code: key.CodeLeftArrow}, NudgeLeft, false, true},
+		{Key{Code: key.CodeLeftArrow, Modifiers: key.ModShift}, NudgeLeft, true, true},
+		// Shift only makes nudges bigger; other actions need their own key.
+		{Key{Code: key.CodeU, Modifiers: key.ModShift}, "", false, false},
+		{Key{Code: key.CodeTab, Modifiers: key.ModShift}, PrevCanvas, false, true},
+	}
+	for _, tt := range tests {
+		a, big, ok := km.lookup(tt.k)
+		if a != tt.action || big != tt.big || ok != tt.ok {
+			t.Errorf("lookup(%v) = %q, %v, %v, want %q, %v, %v", tt.k, a, big, ok, tt.action, tt.big, tt.ok)
+		}
+	}
+
+	for _, bad := range []string{"dance=d", "reset", "reset=hyper+r"} {
+		if err := km.Bind(bad); err == nil {
+			t.Errorf("Bind(%q) succeeded", bad)
+		}
+	}
+}
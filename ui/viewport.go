@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"image"
+	"math"
+
+	"golang.org/x/mobile/event/size"
+)
+
+// viewport places the canvas in the window. The canvas is scaled to fit
+// and centred, keeping its aspect ratio; the rest of the window is left
+// for black bars. Window coordinates are in pixels, as in size and mouse
+// events.
+type viewport struct {
+	// Canvas is the canvas size.
+	Canvas image.Point
+	// Rect is where the canvas is shown in the window.
+	Rect image.Rectangle
+	// Scale is the number of window pixels per UI pixel, for overlays
+	// drawn over the canvas on high-DPI screens.
+	Scale int
+}
+
+// stdPixelsPerPt is the resolution of a 96 DPI screen.
+const stdPixelsPerPt = 96.0 / 72
+
+func newViewport(win size.Event, canvas image.Point) viewport {
+	v := viewport{Canvas: canvas, Rect: win.Bounds(), Scale: 1}
+	if win.PixelsPerPt > 0 {
+		v.Scale = max(1, int(math.Round(float64(win.PixelsPerPt)/stdPixelsPerPt)))
+	}
+	ws := win.Size()
+	if canvas.X <= 0 || canvas.Y <= 0 || ws.X <= 0 || ws.Y <= 0 {
+		return v
+	}
+
+	// Compare ws.X/ws.Y to canvas.X/canvas.Y without rounding.
+	dst := ws
+	if ws.X*canvas.Y > ws.Y*canvas.X {
+		dst.X = ws.Y * canvas.X / canvas.Y
+	} else {
+		dst.Y = ws.X * canvas.Y / canvas.X
+	}
+	off := ws.Sub(dst).Div(2)
+	v.Rect = image.Rectangle{Min: off, Max: off.Add(dst)}
+	return v
+}
+
+// ok reports whether the canvas takes a part of the window.
+func (v viewport) ok() bool {
+	return v.Canvas.X > 0 && v.Canvas.Y > 0 && !v.Rect.Empty()
+}
+
+// toCanvas maps a window position to the canvas. Positions on the bars
+// map outside of the canvas bounds.
+func (v viewport) toCanvas(x, y float32) image.Point {
+	if !v.ok() {
+		return image.Pt(int(x), int(y))
+	}
+	cx := (float64(x) - float64(v.Rect.Min.X)) * float64(v.Canvas.X) / float64(v.Rect.Dx())
+	cy := (float64(y) - float64(v.Rect.Min.Y)) * float64(v.Canvas.Y) / float64(v.Rect.Dy())
+	return image.Pt(int(math.Floor(cx)), int(math.Floor(cy)))
+}
+
+// fromCanvas maps a rectangle on the canvas to the window.
+func (v viewport) fromCanvas(r image.Rectangle) image.Rectangle {
+	if !v.ok() {
+		return r
+	}
+	scale := func(p image.Point) image.Point {
+		return image.Pt(
+			v.Rect.Min.X+int(math.Round(float64(p.X*v.Rect.Dx())/float64(v.Canvas.X))),
+			v.Rect.Min.Y+int(math.Round(float64(p.Y*v.Rect.Dy())/float64(v.Canvas.Y))),
+		)
+	}
+	return image.Rectangle{Min: scale(r.Min), Max: scale(r.Max)}
+}
+
+// bars returns the parts of the window not covered by the canvas.
+func (v viewport) bars(win image.Rectangle) []image.Rectangle {
+	if !v.ok() {
+		return []image.Rectangle{win}
+	}
+	var bars []image.Rectangle
+	for _, r := range []image.Rectangle{
+		image.Rect(win.Min.X, win.Min.Y, win.Max.X, v.Rect.Min.Y),
+		image.Rect(win.Min.X, v.Rect.Max.Y, win.Max.X, win.Max.Y),
+		image.Rect(win.Min.X, v.Rect.Min.Y, v.Rect.Min.X, v.Rect.Max.Y),
+		image.Rect(v.Rect.Max.X, v.Rect.Min.Y, win.Max.X, v.Rect.Max.Y),
+	} {
+		if !r.Empty() {
+			bars = append(bars, r)
+		}
+	}
+	return bars
+}
@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"image"
+	"testing"
+
+	"golang.org/x/mobile/event/size"
+)
+
+func TestViewport(t *testing.T) {
+	canvas := image.Pt(800, 800)
+	tests := []struct {
+		name      string
+		win       size.Event
+		wantRect  image.Rectangle
+		wantScale int
+		// at is a window position and want the canvas position under it.
+		at   image.Point
+		want image.Point
+	}{
+		{
+			name:      "same size",
+			win:       size.Event{WidthPx: 800, HeightPx: 800},
+			wantRect:  image.Rect(0, 0, 800, 800),
+			wantScale: 1,
+			at:        image.Pt(400, 10),
+			want:      image.Pt(400, 10),
+		},
+		{
+			name:      "wide window",
+			win:       size.Event{WidthPx: 1000, HeightPx: 400},
+			wantRect:  image.Rect(300, 0, 700, 400),
+			wantScale: 1,
+			at:        image.Pt(350, 100),
+			want:      image.Pt(100, 200),
+		},
+		{
+			name:      "tall window",
+			win:       size.Event{WidthPx: 400, HeightPx: 1000},
+			wantRect:  image.Rect(0, 300, 400, 700),
+			wantScale: 1,
+			at:        image.Pt(200, 250),
+			want:      image.Pt(400, -100),
+		},
+		{
+			name:      "high DPI",
+			win:       size.Event{WidthPx: 1600, HeightPx: 1600, PixelsPerPt: 192.0 / 72},
+			wantRect:  image.Rect(0, 0, 1600, 1600),
+			wantScale: 2,
+			at:        image.Pt(801, 1599),
+			want:      image.Pt(400, 799),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vp := newViewport(tt.win, canvas)
+			if vp.Rect != tt.wantRect || vp.Scale != tt.wantScale {
+				t.Fatalf("viewport = %v scale %d, want %v scale %d", vp.Rect, vp.Scale, tt.wantRect, tt.wantScale)
+			}
+			if got := vp.toCanvas(float32(tt.at.X), float32(tt.at.Y)); got != tt.want {
+				t.Errorf("toCanvas(%v) = %v, want %v", tt.at, got, tt.want)
+			}
+			r := image.Rect(100, 100, 300, 200)
+			back := vp.fromCanvas(r)
+			lo, hi := vp.toCanvas(float32(back.Min.X), float32(back.Min.Y)), vp.toCanvas(float32(back.Max.X), float32(back.Max.Y))
+			if lo != r.Min || hi != r.Max {
+				t.Errorf("fromCanvas(%v) = %v, which maps back to %v-%v", r, back, lo, hi)
+			}
+
+			covered := vp.Rect.Dx() * vp.Rect.Dy()
+			for _, b := range vp.bars(tt.win.Bounds()) {
+				if b.Overlaps(vp.Rect) {
+					t.Errorf("bar %v overlaps the canvas", b)
+				}
+				covered += b.Dx() * b.Dy()
+			}
+			if ws := tt.win.Size(); covered != ws.X*ws.Y {
+				t.Errorf("bars and canvas cover %d pixels, want %d", covered, ws.X*ws.Y)
+			}
+		})
+	}
+}
+
+func TestViewport_NoCanvas(t *testing.T) {
+	vp := newViewport(size.Event{WidthPx: 300, HeightPx: 200}, image.Point{})
+	if got := vp.toCanvas(10, 20); got != image.Pt(10, 20) {
+		t.Errorf("toCanvas() = %v, want the window position", got)
+	}
+	if bars := vp.bars(image.Rect(0, 0, 300, 200)); len(bars) != 1 || bars[0] != image.Rect(0, 0, 300, 200) {
+		t.Errorf("bars() = %v, want the whole window", bars)
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"image/color"
 	"log"
 	"sync"
+	"time"
 
 	"golang.org/x/exp/shiny/driver"
 	"golang.org/x/exp/shiny/imageutil"
 	"golang.org/x/exp/shiny/screen"
 	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
 	"golang.org/x/mobile/event/key"
 	"golang.org/x/mobile/event/lifecycle"
 	"golang.org/x/mobile/event/mouse"
@@ -18,46 +22,109 @@ import (
 )
 
 type Visualizer struct {
-	Title         string
-	Debug         bool
+	Title string
+	// Size is the initial window size, 800x800 if not set.
+	Size image.Point
+	// Debug logs window events and shows the debug overlay, which can also
+	// be toggled from the keyboard. The overlay is drawn over the window
+	// only and never gets into the frames of the canvas.
+	Debug bool
+	// Stats returns the state of the shown canvas for the debug overlay.
+	Stats         func() HUDStats
 	OnScreenReady func(s screen.Screen)
 
-	w    screen.Window
-	tx   chan screen.Texture
+	w screen.Window
+	// tx asks the window to repaint after a new frame.
+	tx   chan struct{}
 	done chan struct{}
 
 	sz size.Event
 	mu sync.Mutex
 
-	bgColor    color.Color
-	figurePos  image.Point
-	figureSize int
-
+	// currentTexture is the shown frame, leased from the Loop until
+	// release is called.
 	currentTexture screen.Texture
+	release        func()
+
+	// Mouse callbacks get positions on the canvas. OnPress and OnRelease
+	// are called for the left button and OnDrag for moves while it is held.
+	OnPress      func(p image.Point)
+	OnDrag       func(p image.Point)
+	OnRelease    func(p image.Point)
+	OnRightClick func(p image.Point)
+	// OnWheel gets the number of wheel steps, positive for scrolling up.
+	OnWheel func(p image.Point, steps int)
+	// Selection returns the bounds of the selected figure on the canvas,
+	// which is highlighted in the window.
+	Selection func() (image.Rectangle, bool)
+
+	// OnSwitchCanvas is called when the user asks for the next (Tab) or the
+	// previous (Shift+Tab) canvas.
+	OnSwitchCanvas func(forward bool)
+
+	// Keys binds keys to actions, DefaultKeymap() if nil. The actions call
+	// the callbacks below; nil callbacks are skipped.
+	Keys Keymap
+	// OnNudge moves the selected figure by d.
+	OnNudge           func(d image.Point)
+	OnReset           func()
+	OnUpdate          func()
+	OnScreenshot      func()
+	OnCycleBackground func()
+
+	screen   screen.Screen
+	showHelp bool
+	dragging bool
+
+	// fps counts the received frames; mouse is the pointer position on
+	// the canvas and mouseIn tells whether it is over the canvas.
+	fps     fpsCounter
+	mouse   image.Point
+	mouseIn bool
+}
 
-	OnMove func(p image.Point)
+// Repaint asks the window to draw again without a new frame, e.g. after
+// the selection changed. It does nothing before the window is open.
+func (v *Visualizer) Repaint() {
+	if v.w != nil {
+		v.w.Send(paint.Event{})
+	}
 }
 
-func (v *Visualizer) Update(t screen.Texture) {
+// Update shows t and gives the previous frame back to the Loop. Paint reads
+// the texture under mu, so it is not in use once replaced.
+func (v *Visualizer) Update(t screen.Texture, release func()) {
 	log.Println("Visualizer: received texture update")
 	v.mu.Lock()
-	v.currentTexture = t
+	prev := v.release
+	v.currentTexture, v.release = t, release
+	v.fps.add(time.Now())
 	v.mu.Unlock()
 
-	v.tx <- t
+	if prev != nil {
+		prev()
+	}
+	select {
+	case v.tx <- struct{}{}:
+	default:
+		// A repaint is pending already.
+	}
 }
 
 func (v *Visualizer) Main() {
-	v.tx = make(chan screen.Texture)
+	v.tx = make(chan struct{}, 1)
 	v.done = make(chan struct{})
 	driver.Main(v.run)
 }
 
 func (v *Visualizer) run(s screen.Screen) {
+	if v.Size == (image.Point{}) {
+		v.Size = image.Pt(800, 800)
+	}
 	w, err := s.NewWindow(&screen.NewWindowOptions{
 		Title:  v.Title,
-		Width:  800,
-		Height: 800,
+		Width:  v.Size.X,
+		Height: v.Size.Y,
 	})
 	if err != nil {
 		log.Fatal("Failed to create window:", err)
@@ -68,9 +135,10 @@ func (v *Visualizer) run(s screen.Screen) {
 	}()
 
 	v.w = w
-	v.bgColor = color.RGBA{0, 128, 0, 255}
-	v.figureSize = 200
-	v.figurePos = image.Point{X: 400, Y: 400}
+	v.screen = s
+	if v.Keys == nil {
+		v.Keys = DefaultKeymap()
+	}
 	if v.OnScreenReady != nil {
 		v.OnScreenReady(s)
 	}
@@ -79,9 +147,6 @@ func (v *Visualizer) run(s screen.Screen) {
 	go func() {
 		for {
 			e := w.NextEvent()
-			if v.Debug {
-				log.Printf("event: %v", e)
-			}
 			if detectTerminate(e) {
 				close(events)
 				break
@@ -90,17 +155,15 @@ func (v *Visualizer) run(s screen.Screen) {
 		}
 	}()
 
-	var t screen.Texture
-
 	for {
 		select {
 		case e, ok := <-events:
 			if !ok {
 				return
 			}
-			v.handleEvent(e, t)
+			v.handleEvent(e)
 
-		case t = <-v.tx:
+		case <-v.tx:
 			w.Send(paint.Event{})
 		}
 	}
@@ -116,7 +179,10 @@ func detectTerminate(e any) bool {
 	return false
 }
 
-func (v *Visualizer) handleEvent(e any, t screen.Texture) {
+func (v *Visualizer) handleEvent(e any) {
+	if v.Debug {
+		log.Printf("event: %v", e)
+	}
 	switch e := e.(type) {
 	case size.Event:
 		v.sz = e
@@ -124,57 +190,198 @@ func (v *Visualizer) handleEvent(e any, t screen.Texture) {
 	case error:
 		log.Printf("ERROR: %v", e)
 
+	case key.Event:
+		// Held keys repeat with DirNone.
+		if e.Direction == key.DirRelease {
+			break
+		}
+		if a, big, ok := v.Keys.lookup(Key{Code: e.Code, Modifiers: e.Modifiers}); ok {
+			v.do(a, big)
+		}
+
 	case mouse.Event:
-		if e.Button == mouse.ButtonLeft && e.Direction == mouse.DirPress {
-			if v.OnMove != nil {
-				v.OnMove(image.Point{X: int(e.X), Y: int(e.Y)})
-			}
+		p := v.toCanvas(e.X, e.Y)
+		if v.Debug {
 			v.mu.Lock()
-			v.figurePos = image.Point{X: int(e.X), Y: int(e.Y)}
+			v.mouse = p
+			v.mouseIn = v.currentTexture != nil && p.In(v.currentTexture.Bounds())
 			v.mu.Unlock()
 			v.w.Send(paint.Event{})
 		}
+		call := func(f func(image.Point)) {
+			if f != nil {
+				f(p)
+			}
+		}
+		switch {
+		case e.Button == mouse.ButtonLeft && e.Direction == mouse.DirPress:
+			v.dragging = true
+			call(v.OnPress)
+		case e.Button == mouse.ButtonLeft && e.Direction == mouse.DirRelease:
+			v.dragging = false
+			call(v.OnRelease)
+		case e.Direction == mouse.DirNone && v.dragging:
+			call(v.OnDrag)
+		case e.Button == mouse.ButtonRight && e.Direction == mouse.DirPress:
+			call(v.OnRightClick)
+		case e.Button.IsWheel() && e.Direction != mouse.DirRelease && v.OnWheel != nil:
+			switch e.Button {
+			case mouse.ButtonWheelUp:
+				v.OnWheel(p, 1)
+			case mouse.ButtonWheelDown:
+				v.OnWheel(p, -1)
+			}
+		}
 
 	case paint.Event:
 		v.mu.Lock()
 		defer v.mu.Unlock()
 
-		if v.currentTexture == nil {
-			v.drawScene()
-		} else {
-			v.w.Scale(v.sz.Bounds(), v.currentTexture, v.currentTexture.Bounds(), draw.Src, nil)
+		// The Loop presents its first frame right after the screen is
+		// ready; until then the window stays black.
+		vp := v.viewportLocked()
+		for _, r := range vp.bars(v.sz.Bounds()) {
+			v.w.Fill(r, color.Black, draw.Src)
+		}
+		if v.currentTexture != nil {
+			v.w.Scale(vp.Rect, v.currentTexture, v.currentTexture.Bounds(), draw.Src, nil)
+		}
+		v.drawSelection(vp)
+		if v.Debug {
+			v.drawHUD(vp)
+		}
+		if v.showHelp {
+			v.drawHelp(vp)
 		}
 		v.w.Publish()
 	}
 }
 
-func (v *Visualizer) drawScene() {
-	v.w.Fill(v.sz.Bounds(), v.bgColor, draw.Src)
+// viewportLocked places the current texture in the window.
+func (v *Visualizer) viewportLocked() viewport {
+	var canvas image.Point
+	if v.currentTexture != nil {
+		canvas = v.currentTexture.Size()
+	}
+	return newViewport(v.sz, canvas)
+}
+
+// toCanvas maps a window position to the canvas.
+func (v *Visualizer) toCanvas(x, y float32) image.Point {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.viewportLocked().toCanvas(x, y)
+}
 
-	v.drawT180(v.figurePos, v.figureSize)
+// drawSelection frames the selected figure.
+func (v *Visualizer) drawSelection(vp viewport) {
+	if v.Selection == nil {
+		return
+	}
+	r, ok := v.Selection()
+	if !ok {
+		return
+	}
+	thickness := 2 * vp.Scale
+	r = vp.fromCanvas(r).Inset(-thickness - vp.Scale)
+	for _, br := range imageutil.Border(r, thickness) {
+		v.w.Fill(br, color.RGBA{0, 200, 255, 255}, draw.Src)
+	}
+}
 
-	for _, br := range imageutil.Border(v.sz.Bounds(), 10) {
-		v.w.Fill(br, color.White, draw.Src)
+func (v *Visualizer) do(a Action, big bool) {
+	step := NudgeStep
+	if big {
+		step = BigNudgeStep
+	}
+	call := func(f func()) {
+		if f != nil {
+			f()
+		}
+	}
+	nudge := func(dx, dy int) {
+		if v.OnNudge != nil {
+			v.OnNudge(image.Pt(dx*step, dy*step))
+		}
+	}
+	switch a {
+	case NudgeLeft:
+		nudge(-1, 0)
+	case NudgeRight:
+		nudge(1, 0)
+	case NudgeUp:
+		nudge(0, -1)
+	case NudgeDown:
+		nudge(0, 1)
+	case Reset:
+		call(v.OnReset)
+	case Update:
+		call(v.OnUpdate)
+	case Screenshot:
+		call(v.OnScreenshot)
+	case CycleBackground:
+		call(v.OnCycleBackground)
+	case NextCanvas, PrevCanvas:
+		if v.OnSwitchCanvas != nil {
+			v.OnSwitchCanvas(a == NextCanvas)
+		}
+	case Help:
+		v.showHelp = !v.showHelp
+		v.w.Send(paint.Event{})
+	case ToggleDebug:
+		v.Debug = !v.Debug
+		v.w.Send(paint.Event{})
 	}
 }
 
-func (v *Visualizer) drawT180(center image.Point, size int) {
-	thickness := size / 5
-	half := size / 2
-
-	horzRect := image.Rect(
-		center.X-half,
-		center.Y-thickness/2,
-		center.X+half,
-		center.Y+thickness/2,
-	)
-	vertRect := image.Rect(
-		center.X-thickness/2,
-		center.Y-thickness/2,
-		center.X+thickness/2,
-		center.Y-half,
-	)
-
-	v.w.Fill(horzRect, color.RGBA{255, 255, 0, 255}, draw.Src)
-	v.w.Fill(vertRect, color.RGBA{255, 255, 0, 255}, draw.Src)
+// drawHelp draws the key bindings over the top left corner of the canvas.
+func (v *Visualizer) drawHelp(vp viewport) {
+	lines := append([]string{"Keys (? to close)", ""}, v.Keys.help()...)
+	v.drawPanel(vp, vp.Rect.Min.Add(image.Pt(panelPad, panelPad).Mul(vp.Scale)), lines)
+}
+
+// panelPad is the padding of text panels in UI pixels.
+const panelPad = 8
+
+// panelSize returns the size of a text panel in UI pixels.
+func panelSize(lines []string) image.Point {
+	face := basicfont.Face7x13
+	width := 0
+	for _, l := range lines {
+		width = max(width, len(l))
+	}
+	return image.Pt(width*face.Advance+2*panelPad, len(lines)*face.Height+2*panelPad)
+}
+
+// drawPanel draws lines of text on a dark panel at the window position at,
+// enlarged on high-DPI screens.
+func (v *Visualizer) drawPanel(vp viewport, at image.Point, lines []string) {
+	face := basicfont.Face7x13
+	size := panelSize(lines)
+	buf, err := v.screen.NewBuffer(size)
+	if err != nil {
+		log.Printf("Cannot draw text: %s", err)
+		return
+	}
+	defer buf.Release()
+
+	img := buf.RGBA()
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{32, 32, 32, 255}), image.Point{}, draw.Src)
+	d := font.Drawer{Dst: img, Src: image.White, Face: face}
+	for i, l := range lines {
+		d.Dot = fixed.P(panelPad, panelPad+face.Ascent+i*face.Height)
+		d.DrawString(l)
+	}
+	if vp.Scale == 1 {
+		v.w.Upload(at, buf, buf.Bounds())
+		return
+	}
+	t, err := v.screen.NewTexture(size)
+	if err != nil {
+		log.Printf("Cannot draw text: %s", err)
+		return
+	}
+	defer t.Release()
+	t.Upload(image.Point{}, buf, buf.Bounds())
+	v.w.Scale(image.Rectangle{Min: at, Max: at.Add(size.Mul(vp.Scale))}, t, t.Bounds(), draw.Src, nil)
 }
@@ -0,0 +1,20 @@
+package ui
+
+import "testing"
+
+func TestVisualizer_UpdateReleasesPreviousFrame(t *testing.T) {
+	var (
+		v        Visualizer
+		released []int
+	)
+	v.tx = make(chan struct{}, 1)
+	for i := range 3 {
+		v.Update(nil, func() { released = append(released, i) })
+	}
+	if len(released) != 2 || released[0] != 0 || released[1] != 1 {
+		t.Errorf("released frames %v, want [0 1]", released)
+	}
+	if len(v.tx) != 1 {
+		t.Errorf("%d repaints pending, want 1", len(v.tx))
+	}
+}